@@ -0,0 +1,131 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	bench_re    = flag.String("bench", "", "Run the benchmarks matching this regular expression on every change, and compare them with the previous run")
+	bench_pkg   = flag.String("bench-pkg", "", "Package with the benchmarks of --bench, the program's by default")
+	bench_count = flag.Int("bench-count", 3, "How often every benchmark of --bench runs, the mean is compared")
+)
+
+// the directory the results of the last benchmark run are kept in.
+var benchDir = filepath.Join(".rerun", "bench")
+
+// a benchResult holds the means of the measurements of a benchmark, by
+// unit, e.g. ns/op.
+type benchResult map[string]float64
+
+// runBenchmarks runs the --bench benchmarks and prints how they changed
+// since the last run. Failing benchmarks don't keep the program from
+// being restarted.
+func runBenchmarks(buildpath string) {
+	pkg := *bench_pkg
+	if pkg == "" {
+		pkg = buildpath
+	}
+	cmdline := []string{"test", "-run=^$", "-bench=" + *bench_re, "-benchmem", "-count=" + strconv.Itoa(*bench_count)}
+	if *build_tags != "" {
+		cmdline = append(cmdline, "-tags", *build_tags)
+	}
+	cmd := exec.Command("go", append(cmdline, pkg)...)
+	cmd.Env = buildEnv()
+	logCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		fmt.Print(string(out))
+		log.Printf("benchmarks failed: %s", err)
+		return
+	}
+
+	results := parseBenchmarks(out)
+	if len(results) == 0 {
+		log.Printf("no benchmarks match %q", *bench_re)
+		return
+	}
+	file := filepath.Join(benchDir, targetName(pkg)+".json")
+	var previous map[string]benchResult
+	if data, err := ioutil.ReadFile(file); err == nil {
+		json.Unmarshal(data, &previous)
+	}
+	printBenchmarks(previous, results)
+
+	if err := os.MkdirAll(benchDir, 0755); err == nil {
+		data, _ := json.Marshal(results)
+		ioutil.WriteFile(file, data, 0644)
+	}
+}
+
+// parseBenchmarks returns the means of the benchmark lines of go test's
+// output, like
+//
+//	BenchmarkFoo-8   	 1000000	      1042 ns/op	      64 B/op	       2 allocs/op
+func parseBenchmarks(out []byte) (results map[string]benchResult) {
+	results = map[string]benchResult{}
+	counts := map[string]map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := fields[0]
+		if results[name] == nil {
+			results[name] = benchResult{}
+			counts[name] = map[string]int{}
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			unit := fields[i+1]
+			n := counts[name][unit]
+			results[name][unit] = (results[name][unit]*float64(n) + v) / float64(n+1)
+			counts[name][unit] = n + 1
+		}
+	}
+	return
+}
+
+// printBenchmarks prints the results with their change since previous,
+// in the units of benchstat.
+func printBenchmarks(previous, results map[string]benchResult) {
+	var names []string
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var columns []string
+		for _, unit := range []string{"ns/op", "B/op", "allocs/op"} {
+			v, ok := results[name][unit]
+			if !ok {
+				continue
+			}
+			column := fmt.Sprintf("%.4g %s", v, unit)
+			if old, ok := previous[name][unit]; ok && old > 0 {
+				column += fmt.Sprintf(" (%+.1f%%)", (v-old)/old*100)
+			}
+			columns = append(columns, column)
+		}
+		fmt.Printf("%-40s %s\n", name, strings.Join(columns, "   "))
+	}
+}
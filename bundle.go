@@ -0,0 +1,214 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a bundle is everything needed to set up the same loop elsewhere, as
+// written by "rerun bundle export". It never holds secret values: values of
+// env settings are removed, and the env file is only a template of its keys.
+type bundle struct {
+	SchemaVersion int `json:"schema_version"`
+
+	Config      string `json:"config"`
+	EnvFile     string `json:"env_file,omitempty"`
+	EnvTemplate string `json:"env_template,omitempty"`
+}
+
+func bundleCmd(args []string) (err error) {
+	if len(args) < 1 {
+		return errors.New("Usage: rerun bundle export [file] | import <file>")
+	}
+	switch args[0] {
+	case "export":
+		name := "rerun-bundle.json"
+		if len(args) > 1 {
+			name = args[1]
+		}
+		err = exportBundle(name)
+	case "import":
+		if len(args) < 2 {
+			return errors.New("Usage: rerun bundle import <file>")
+		}
+		err = importBundle(args[1])
+	default:
+		err = fmt.Errorf("unknown bundle command %q", args[0])
+	}
+	return
+}
+
+func exportBundle(name string) (err error) {
+	var data []byte
+	if isRemoteConfig(*config_path) {
+		data, err = fetchConfig(*config_path)
+	} else {
+		data, err = ioutil.ReadFile(*config_path)
+	}
+	if err != nil {
+		return
+	}
+	cf, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", *config_path, err)
+	}
+
+	b := bundle{SchemaVersion: schemaVersion, Config: cf.redacted().String()}
+	if *env_file != "" {
+		data, err = ioutil.ReadFile(*env_file)
+		if err != nil {
+			return
+		}
+		b.EnvFile = *env_file
+		for _, kv := range parseDotenv(data) {
+			b.EnvTemplate += kv[:strings.Index(kv, "=")] + "=\n"
+		}
+	}
+
+	data, err = json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(name, data, 0644)
+	if err == nil {
+		log.Printf("exported to %s", name)
+	}
+	return
+}
+
+func importBundle(name string) (err error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	var b bundle
+	err = json.Unmarshal(data, &b)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	err = checkSchemaVersion(strconv.Itoa(b.SchemaVersion))
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	err = writeNew(*config_path, b.Config)
+	if err != nil {
+		return
+	}
+	if b.EnvFile != "" {
+		err = writeNew(b.EnvFile, b.EnvTemplate)
+		if err == nil {
+			log.Printf("fill in the values in %s", b.EnvFile)
+		}
+	}
+	return
+}
+
+// writeNew writes a file that must not exist yet.
+func writeNew(name, content string) (err error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("not overwriting existing %s", name)
+	}
+	if err != nil {
+		return
+	}
+	_, err = f.WriteString(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		log.Printf("wrote %s", name)
+	}
+	return
+}
+
+// redacted returns a copy of cf with the values of env settings removed.
+func (cf configFile) redacted() (r configFile) {
+	redact := func(c config) config {
+		rc := config{}
+		for key, values := range c {
+			if key == "env" {
+				var keys []string
+				for _, kv := range values {
+					keys = append(keys, strings.SplitN(kv, "=", 2)[0]+"=")
+				}
+				values = keys
+			}
+			rc[key] = values
+		}
+		return rc
+	}
+	r.settings = redact(cf.settings)
+	r.profiles = map[string]config{}
+	for name, p := range cf.profiles {
+		r.profiles[name] = redact(p)
+	}
+	r.stages = cf.stages
+	return
+}
+
+// String formats cf as a config file.
+func (cf configFile) String() string {
+	buf := bytes.NewBuffer([]byte{})
+	cf.settings.write(buf)
+	var names []string
+	for name := range cf.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(buf, "\n[profile.%s]\n", name)
+		cf.profiles[name].write(buf)
+	}
+	for _, st := range cf.stages {
+		fmt.Fprintf(buf, "\n[stage.%s]\n", st.name)
+		st.c.write(buf)
+	}
+	return buf.String()
+}
+
+func (c config) write(buf *bytes.Buffer) {
+	var keys []string
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := c[key]
+		// repeatable flags are always written as a list.
+		repeatable := false
+		if f := flag.Lookup(key); f != nil {
+			_, repeatable = f.Value.(*stringList)
+		}
+		if len(values) == 1 && !repeatable {
+			fmt.Fprintf(buf, "%s = %s\n", key, strconv.Quote(values[0]))
+			continue
+		}
+		fmt.Fprintf(buf, "%s = %s\n", key, quoteList(values))
+	}
+}
+
+// quoteList formats values as a list of quoted strings, which reads the
+// same in TOML and JSON.
+func quoteList(values []string) string {
+	buf := bytes.NewBuffer([]byte{})
+	enc := json.NewEncoder(buf)
+	// globs and rules contain <, > and &.
+	enc.SetEscapeHTML(false)
+	enc.Encode(values)
+	return strings.TrimSpace(buf.String())
+}
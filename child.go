@@ -0,0 +1,256 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/ccll/rerun/pkg/rerun"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	run_timeout = flag.Duration("run-timeout", 0, "Kill the program when it runs longer than this")
+	child_dir   = flag.String("chdir", "", "Run the program in this directory")
+)
+
+// a child is a running instance of the program.
+type child struct {
+	name string
+	cmd  *exec.Cmd
+	// called when the process exits by itself, may be nil.
+	afterExit func()
+	// closed once the process has exited and was waited for.
+	exited chan bool
+	// the terminal the process runs in with --pty.
+	pty *pty
+	// the process and the ones it starts.
+	group *procGroup
+	// starts and stops the process.
+	sup *rerun.Supervisor
+
+	// whether the program got ready, valid once readyDone is closed.
+	readyOnce sync.Once
+	readyDone chan bool
+	ready     bool
+
+	// how the process exited, valid once exited is closed.
+	err error
+
+	mu       sync.Mutex
+	stopped  bool
+	timedOut bool
+	timer    *time.Timer
+}
+
+// shellCommand runs cmdline with the system's shell.
+func shellCommand(cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmdline)
+	}
+	return exec.Command("sh", "-c", cmdline)
+}
+
+// childEnv is the environment of the program, or nil when it just
+// inherits rerun's.
+func childEnv() (env []string, err error) {
+	env = hardwareEnv()
+	uenv, err := userEnv()
+	if err != nil {
+		return
+	}
+	env = append(env, uenv...)
+	senv, err := secretEnv()
+	if err != nil {
+		return
+	}
+	env = append(env, senv...)
+	env = append(env, worktreePorts...)
+	if len(env) > 0 {
+		env = append(os.Environ(), env...)
+	}
+	return
+}
+
+// childCommand sets up the command running the program, with its output
+// going to stdout and stderr. Its stdin is fed from stdin, if not nil.
+func childCommand(binPath string, args []string, stdin []byte, stdout, stderr io.Writer) (cmd *exec.Cmd, err error) {
+	args = scriptArgs(binPath, args)
+	cmd = exec.Command(binPath, args...)
+	if *debug_mode {
+		cmd = debugCommand(binPath, args)
+	}
+	cmd.Dir = *child_dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Env, err = childEnv()
+	if err != nil {
+		return
+	}
+	cmd, err = withListeners(cmd)
+	if err != nil {
+		return
+	}
+	openPanic := func(file string, line int) {
+		openEditor(file, line, 0)
+	}
+	// the log file gets all of the output, the terminal the filtered lines.
+	stdout = withLogFile(withFilter(stdout))
+	stderr = withLogFile(withFilter(stderr))
+	cmd.Stdout = stdout
+	cmd.Stderr = newPanicScanner(stderr, openPanic)
+	if *use_pty {
+		// the terminal merges stderr into stdout.
+		cmd.Stdout = newPanicScanner(stdout, openPanic)
+	}
+	return
+}
+
+// startChild starts cmd and reports how it exits, unless it is stopped
+// by rerun. afterExit, if not nil, is called when the process exits by
+// itself.
+func startChild(name string, cmd *exec.Cmd, afterExit func()) (c *child, err error) {
+	var p *pty
+	if *use_pty {
+		p, err = startPty(cmd)
+		if err != nil {
+			return
+		}
+	}
+	prepareGroup(cmd)
+	c = &child{
+		name:      name,
+		cmd:       cmd,
+		afterExit: afterExit,
+		exited:    make(chan bool),
+		pty:       p,
+	}
+	c.sup = &rerun.Supervisor{
+		Command: func() (*exec.Cmd, error) {
+			return cmd, nil
+		},
+		// the program is only killed when interrupting it fails.
+		StopTimeout: -1,
+		Interrupt:   c.interrupt,
+		Kill: func(*exec.Cmd) error {
+			return c.group.kill()
+		},
+		OnStart: c.started,
+		OnExit:  c.exit,
+	}
+	err = c.sup.Start()
+	if err != nil {
+		if p != nil {
+			p.started()
+			p.close()
+		}
+		return nil, err
+	}
+	return
+}
+
+// started is called once the process is running.
+func (c *child) started(pid int) {
+	if c.pty != nil {
+		c.pty.started()
+	}
+	group, err := newProcGroup(c.cmd)
+	if err != nil {
+		log.Printf("error on grouping the processes of %s: '%s'\n", c.name, err)
+	}
+	c.group = group
+	if *run_timeout > 0 {
+		c.timer = time.AfterFunc(*run_timeout, c.timeout)
+	}
+	liveChildren.Lock()
+	liveChildren.m[c] = true
+	liveChildren.Unlock()
+}
+
+// exit is called with how the process exited, once it was waited for.
+func (c *child) exit(err error) {
+	c.err = err
+	c.group.close()
+	liveChildren.Lock()
+	delete(liveChildren.m, c)
+	liveChildren.Unlock()
+	if c.pty != nil {
+		c.pty.close()
+	}
+
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	stopped, timedOut := c.stopped, c.timedOut
+	c.mu.Unlock()
+
+	switch {
+	case stopped:
+		emit(eventRunExit, c.name, "stopped")
+	case timedOut:
+		log.Printf("%s timed out after %s and was killed", c.name, *run_timeout)
+		emit(eventRunExit, c.name, "timed out")
+	case err != nil:
+		log.Printf("%s exited: %s", c.name, err)
+		emit(eventRunExit, c.name, err.Error())
+	default:
+		log.Printf("%s exited", c.name)
+		emit(eventRunExit, c.name, "exited")
+	}
+	if !stopped {
+		emit(eventState, c.name, stateExited)
+	}
+	if !stopped && !timedOut && c.afterExit != nil {
+		c.afterExit()
+	}
+	close(c.exited)
+	if !stopped && *exit_with_program && !*run_once {
+		exitRerun(exitCode(err))
+	}
+}
+
+func (c *child) timeout() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	c.timedOut = true
+	c.group.kill()
+}
+
+// interrupt asks the process to exit, the supervisor kills it when this
+// fails.
+func (c *child) interrupt(*exec.Cmd) error {
+	// delve keeps running when interrupted, killing it kills the program.
+	if *debug_mode {
+		c.group.kill()
+		return nil
+	}
+	err := c.group.interrupt()
+	if err != nil {
+		log.Printf("error on sending signal to process: '%s', will now hard-kill the process\n", err)
+	}
+	return err
+}
+
+// stop interrupts the process and waits for it to exit.
+func (c *child) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+
+	c.sup.Stop()
+	// another stop may have taken the process over.
+	<-c.exited
+}
@@ -0,0 +1,158 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	compose_file     = flag.String("compose", "", "docker compose file with the services the program depends on, brought up before the first start and down on exit")
+	compose_services stringList
+	compose_restart  stringList
+)
+
+func init() {
+	flag.Var(&compose_services, "compose-service", "Service of --compose to bring up, all of them if none are given (repeatable)")
+	flag.Var(&compose_restart, "compose-restart", "Restart a service of --compose when a file matching a glob changes (repeatable): SERVICE=<glob>, e.g. db=migrations/**")
+}
+
+// composeUp is true once the services have been brought up.
+var composeUp bool
+
+// composeCommand runs docker compose with the --compose file.
+func composeCommand(args ...string) (err error) {
+	cmd := exec.Command("docker", append([]string{"compose", "-f", *compose_file}, args...)...)
+	cmd.Stdout = newPrefixWriter(os.Stdout, "[compose] ")
+	cmd.Stderr = newPrefixWriter(os.Stderr, "[compose] ")
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("docker compose %s: %s", strings.Join(args, " "), err)
+	}
+	return
+}
+
+// startCompose brings up the services of --compose, and restarts them on
+// changes as given with --compose-restart.
+func startCompose() (err error) {
+	if *compose_file == "" {
+		return
+	}
+	done := timePhase("compose up")
+	err = composeCommand(append([]string{"up", "--detach"}, compose_services...)...)
+	if err != nil {
+		return
+	}
+	composeUp = true
+	log.Printf("compose up %s", roundDuration(done()))
+	return watchCompose()
+}
+
+// stopCompose tears the services of --compose down.
+func stopCompose() {
+	if !composeUp {
+		return
+	}
+	composeUp = false
+	err := composeCommand("down")
+	if err != nil {
+		log.Printf("error on tearing down the compose services: '%s'\n", err)
+	}
+}
+
+// watchCompose polls the directories of the --compose-restart globs, and
+// restarts the services whose files changed.
+func watchCompose() (err error) {
+	globs := map[string][]string{}
+	var dirs []string
+	for _, r := range compose_restart {
+		eq := strings.Index(r, "=")
+		if eq < 0 {
+			return fmt.Errorf("expected --compose-restart=SERVICE=<glob>, got %q", r)
+		}
+		service, glob := r[:eq], r[eq+1:]
+		globs[service] = append(globs[service], glob)
+		dirs = append(dirs, globDirs(glob)...)
+	}
+	if len(dirs) == 0 {
+		return
+	}
+
+	matches := func(service, name string) bool {
+		for _, glob := range globs[service] {
+			if matchGlob(glob, relativeName(name)) {
+				return true
+			}
+		}
+		return false
+	}
+	watcher := rerun.NewPoller(dirs, rerun.DefaultPollInterval)
+	go func() {
+		for {
+			changed, _, _ := rerun.NextChange(watcher, func(name string) bool {
+				for service := range globs {
+					if matches(service, name) {
+						return true
+					}
+				}
+				return false
+			}, nil)
+			for service := range globs {
+				for _, name := range rerun.Names(changed) {
+					if matches(service, name) {
+						log.Printf("%s changed, restarting %s", relativeName(name), service)
+						err := composeCommand("restart", service)
+						if err != nil {
+							log.Print(err)
+						}
+						break
+					}
+				}
+			}
+		}
+	}()
+	return
+}
+
+// globDirs returns the directory a glob starts in, with all directories
+// below it. vendor directories are left out unless --watch-vendor.
+func globDirs(glob string) (dirs []string) {
+	parts := strings.Split(glob, "/")
+	root := "."
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") || i == len(parts)-1 {
+			root = filepath.Join(parts[:i]...)
+			break
+		}
+	}
+	if root == "" {
+		root = "."
+	}
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi.IsDir() {
+			if fi.Name() == ".git" || fi.Name() == ".rerun" {
+				return filepath.SkipDir
+			}
+			if fi.Name() == "vendor" && path != root && !*watch_vendor {
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(path); err == nil {
+				dirs = append(dirs, abs)
+			}
+		}
+		return nil
+	})
+	return
+}
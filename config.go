@@ -0,0 +1,334 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	config_path   = flag.String("config", ".rerun.toml", "Config file (or http(s) URL of one) with default flag values")
+	config_sha256 = flag.String("config-sha256", "", "Expected sha256 of a remote config, fetching fails on mismatch")
+	profile       = flag.String("profile", "", "Profile of the config file to use")
+)
+
+// the directory remote configs are cached in, so rerun still starts when
+// the config server can't be reached.
+var configCacheDir = filepath.Join(".rerun", "config-cache")
+
+// a config file sets flag values, one per line, in a subset of TOML:
+//
+//	# run the tests with the race detector
+//	test = true
+//	race = true
+//	errorfile = "errors.txt"
+//
+// Flags that can be given several times take a list, like
+//
+//	target = ["example.com/cmd/api", "example.com/cmd/worker"]
+//
+// Named profiles override settings for a workflow, and are picked with
+// --profile (or a profile setting):
+//
+//	[profile.integration]
+//	test = true
+//	secret = ["DB_PASSWORD=vault:secret/ci#db"]
+//
+// Stages add steps to the pipeline, see parseStage:
+//
+//	[stage.generate]
+//	command = "go generate ./..."
+//	before = "build"
+//
+// Flags given on the command line take precedence. A config may require a
+// rerun understanding its format with schema_version = 1.
+type config map[string][]string
+
+// a configFile is a config with its profiles and the stages of its
+// pipeline, in order.
+type configFile struct {
+	settings config
+	profiles map[string]config
+	stages   []namedConfig
+}
+
+type namedConfig struct {
+	name string
+	c    config
+}
+
+func parseConfig(data []byte) (cf configFile, err error) {
+	cf.settings = config{}
+	cf.profiles = map[string]config{}
+	c := cf.settings
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			if strings.HasPrefix(section, "stage.") {
+				name := strings.Trim(strings.TrimPrefix(section, "stage."), `"`)
+				c = config{}
+				cf.stages = append(cf.stages, namedConfig{name, c})
+				continue
+			}
+			if !strings.HasPrefix(section, "profile.") {
+				err = fmt.Errorf("line %d: unknown section %q, expected [profile.<name>] or [stage.<name>]", lineno, section)
+				return
+			}
+			name := strings.Trim(strings.TrimPrefix(section, "profile."), `"`)
+			if cf.profiles[name] == nil {
+				cf.profiles[name] = config{}
+			}
+			c = cf.profiles[name]
+			continue
+		}
+		key, values, err := parseSetting(line)
+		if err == nil && key == "schema_version" && len(values) == 1 {
+			err = checkSchemaVersion(values[0])
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return cf, fmt.Errorf("line %d: %s", lineno, err)
+		}
+		c[key] = values
+	}
+	err = scanner.Err()
+	return
+}
+
+// parseSetting parses a key = value line.
+func parseSetting(line string) (key string, values []string, err error) {
+	eq := strings.Index(line, "=")
+	if eq < 0 {
+		err = errors.New("expected key = value")
+		return
+	}
+	key = strings.TrimSpace(line[:eq])
+	value := strings.TrimSpace(line[eq+1:])
+	// what follows the value, only a comment is allowed.
+	var rest string
+	switch {
+	case strings.HasPrefix(value, "["):
+		// a list of quoted strings reads the same in TOML and JSON.
+		dec := json.NewDecoder(strings.NewReader(value))
+		err = dec.Decode(&values)
+		rest = value[dec.InputOffset():]
+	case strings.HasPrefix(value, `"`):
+		var quoted string
+		quoted, err = strconv.QuotedPrefix(value)
+		rest = strings.TrimPrefix(value, quoted)
+		if err == nil {
+			value, err = strconv.Unquote(quoted)
+		}
+		values = []string{value}
+	default:
+		if hash := strings.Index(value, "#"); hash >= 0 {
+			value, rest = strings.TrimSpace(value[:hash]), value[hash:]
+		}
+		values = []string{value}
+	}
+	if rest = strings.TrimSpace(rest); err == nil && rest != "" && !strings.HasPrefix(rest, "#") {
+		err = fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return
+}
+
+// resolve returns the settings with those of the profile given with
+// --profile, or else with the profile setting, applied on top.
+func (cf configFile) resolve() (c config, err error) {
+	name := cf.profileName()
+
+	c = config{}
+	for key, values := range cf.settings {
+		c[key] = values
+	}
+	if name == "" {
+		return
+	}
+	p, ok := cf.profiles[name]
+	if !ok {
+		err = fmt.Errorf("unknown profile %q", name)
+		return
+	}
+	for key, values := range p {
+		c[key] = values
+	}
+	return
+}
+
+// profileName returns the profile given with --profile, or else with the
+// profile setting.
+func (cf configFile) profileName() (name string) {
+	name = *profile
+	if !flagWasSet("profile") && len(cf.settings["profile"]) > 0 {
+		name = cf.settings["profile"][0]
+	}
+	return
+}
+
+// apply sets all flags in c that have not been set on the command line.
+func (c config) apply(fs *flag.FlagSet) (err error) {
+	for key, values := range c {
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if commandLineFlags[key] {
+			continue
+		}
+		for _, value := range values {
+			err = fs.Set(key, value)
+			if err != nil {
+				return fmt.Errorf("setting %q: %s", key, err)
+			}
+		}
+	}
+	return
+}
+
+// flagWasSet reports whether the named flag was given on the command line.
+func flagWasSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+func isRemoteConfig(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchConfig downloads a remote config. When the download fails, the
+// last good copy from the cache is used instead.
+func fetchConfig(url string) (data []byte, err error) {
+	// the config sets flags that run commands, so it must not be
+	// changed on the way.
+	if strings.HasPrefix(url, "http://") && *config_sha256 == "" {
+		err = fmt.Errorf("config %s is fetched without TLS, use https or pin its content with --config-sha256", url)
+		return
+	}
+	sum := sha256.Sum256([]byte(url))
+	cachePath := filepath.Join(configCacheDir, hex.EncodeToString(sum[:]))
+
+	data, err = downloadConfig(url)
+	if err != nil {
+		cached, cacheErr := ioutil.ReadFile(cachePath)
+		if cacheErr != nil {
+			return
+		}
+		log.Printf("could not fetch config: %s, using cached copy", err)
+		data, err = cached, nil
+	}
+
+	// the cached copy may have been fetched with another pin.
+	if *config_sha256 != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, *config_sha256) {
+			err = fmt.Errorf("config %s has sha256 %s, expected %s", url, got, *config_sha256)
+			data = nil
+			return
+		}
+	}
+
+	if err := os.MkdirAll(configCacheDir, 0755); err == nil {
+		ioutil.WriteFile(cachePath, data, 0644)
+	}
+	return
+}
+
+// how long fetching a remote config may take, before the cached copy is
+// used.
+const configTimeout = 10 * time.Second
+
+func downloadConfig(url string) (data []byte, err error) {
+	client := &http.Client{Timeout: configTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("fetching %s: %s", url, resp.Status)
+		return
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+// loadConfig reads the config given with --config and applies it to the
+// command line flags. The config of air, reflex or realize is only read
+// when given with --config.
+func loadConfig() (err error) {
+	flag.Visit(func(f *flag.Flag) {
+		commandLineFlags[f.Name] = true
+	})
+
+	var data []byte
+	if isRemoteConfig(*config_path) {
+		data, err = fetchConfig(*config_path)
+	} else {
+		data, err = ioutil.ReadFile(*config_path)
+		if os.IsNotExist(err) && !flagWasSet("config") {
+			if *profile != "" {
+				return fmt.Errorf("no config file %s for profile %q", *config_path, *profile)
+			}
+			hintForeignConfig()
+			return nil
+		}
+	}
+	if err != nil {
+		return
+	}
+	if isForeignConfig(*config_path) {
+		return applyForeignConfig(*config_path, data)
+	}
+
+	cf, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", *config_path, err)
+	}
+	c, err := cf.resolve()
+	if err != nil {
+		return fmt.Errorf("%s: %s", *config_path, err)
+	}
+	err = c.apply(flag.CommandLine)
+	if err != nil {
+		return fmt.Errorf("%s: %s", *config_path, err)
+	}
+	pipelineStages = nil
+	for _, nc := range cf.stages {
+		st, err := parseStage(nc.name, nc.c)
+		if err != nil {
+			return fmt.Errorf("%s: stage %q: %s", *config_path, nc.name, err)
+		}
+		pipelineStages = append(pipelineStages, st)
+	}
+	loadedConfig, activeProfile = &cf, cf.profileName()
+	return
+}
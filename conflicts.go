@@ -0,0 +1,86 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// conflicts pauses the loop while files have merge conflict markers, which
+// would only lead to a wall of syntax errors.
+type conflicts struct {
+	files map[string]bool
+	// the files that changed while paused.
+	pending []string
+}
+
+// check records which of the changed files have conflict markers. While
+// any file has conflicts, it returns nil. Once all are resolved, it returns
+// all files that changed since the loop was paused.
+func (c *conflicts) check(changed []string) (resume []string) {
+	if c.files == nil {
+		c.files = map[string]bool{}
+	}
+	wasPaused := len(c.files) > 0
+
+	for _, name := range changed {
+		if hasConflictMarkers(name) {
+			c.files[name] = true
+		} else {
+			delete(c.files, name)
+		}
+	}
+
+	if len(c.files) > 0 {
+		c.pending = append(c.pending, changed...)
+		var names []string
+		for name := range c.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("merge conflicts in %s, pausing until they are resolved", strings.Join(names, ", "))
+		return
+	}
+
+	if !wasPaused {
+		return changed
+	}
+	log.Println("merge conflicts resolved, resuming")
+	seen := map[string]bool{}
+	for _, name := range append(c.pending, changed...) {
+		if !seen[name] {
+			seen[name] = true
+			resume = append(resume, name)
+		}
+	}
+	c.pending = nil
+	return
+}
+
+// hasConflictMarkers reports whether the file name has both the start and
+// end marker of a merge conflict at the beginning of a line.
+func hasConflictMarkers(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	start := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "<<<<<<< ") {
+			start = true
+		} else if start && strings.HasPrefix(line, ">>>>>>> ") {
+			return true
+		}
+	}
+	return false
+}
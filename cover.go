@@ -0,0 +1,99 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	do_cover   = flag.Bool("cover", false, "With --test, record the coverage of the tests and regenerate the HTML report in .rerun/cover/cover.html")
+	cover_addr = flag.String("cover-addr", "", "Serve the coverage report of --cover on this address, e.g. localhost:7070, reloading it in the browser after every test run")
+)
+
+// the directory the coverage profile and report are written to.
+var coverDir = filepath.Join(".rerun", "cover")
+
+var (
+	coverProfile = filepath.Join(coverDir, "cover.out")
+	coverHTML    = filepath.Join(coverDir, "cover.html")
+)
+
+// coverArgs returns the arguments of go test recording the coverage
+// with --cover. The profile isn't reachable from --test-in-docker.
+func coverArgs() (args []string) {
+	if !*do_cover || *test_in_docker != "" {
+		return
+	}
+	err := os.MkdirAll(coverDir, 0755)
+	if err != nil {
+		log.Printf("error on creating %s: '%s'\n", coverDir, err)
+		return
+	}
+	abs, err := filepath.Abs(coverProfile)
+	if err != nil {
+		log.Printf("error on finding %s: '%s'\n", coverProfile, err)
+		return
+	}
+	args = []string{"-coverprofile=" + abs}
+	return
+}
+
+// updateCoverage regenerates the HTML report from the coverage profile,
+// logs the total coverage and reloads the browsers showing the report.
+func updateCoverage() {
+	out, err := exec.Command("go", "tool", "cover", "-html="+coverProfile, "-o", coverHTML).CombinedOutput()
+	if err != nil {
+		log.Printf("error on generating the coverage report: '%s'\n%s", err, out)
+		return
+	}
+	out, err = exec.Command("go", "tool", "cover", "-func="+coverProfile).Output()
+	if err == nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		fields := strings.Fields(lines[len(lines)-1])
+		if len(fields) > 0 {
+			infof("coverage: %s of statements", fields[len(fields)-1])
+		}
+	}
+	reloadBrowsers()
+}
+
+// serveCoverage serves the coverage report on addr, with the reload
+// script injected.
+func serveCoverage(addr string) (err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		page, err := ioutil.ReadFile(coverHTML)
+		if err != nil {
+			http.Error(w, "no coverage report yet, waiting for the tests to pass", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(injectReload(page))
+	})
+	handleReload(mux)
+	go func() {
+		err := http.Serve(l, mux)
+		log.Printf("error on serving the coverage report: '%s'\n", err)
+	}()
+	log.Printf("serving the coverage report on http://%s", l.Addr())
+	return
+}
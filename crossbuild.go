@@ -0,0 +1,61 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"go/build"
+	"log"
+	"os"
+	"runtime"
+)
+
+var (
+	target_goos   = flag.String("goos", "", "Build for this GOOS, e.g. with --no-run or --remote")
+	target_goarch = flag.String("goarch", "", "Build for this GOARCH, e.g. with --no-run or --remote")
+	build_env     stringList
+)
+
+func init() {
+	flag.Var(&build_env, "build-env", "Put KEY=VALUE into the environment of the go commands building and testing the program (repeatable), e.g. GOARM=7 or CGO_ENABLED=0")
+}
+
+// setupCrossBuild makes the packages be looked at as for the target
+// platform, so the build constraints of --goos and --goarch apply to the
+// watched files as well.
+func setupCrossBuild() {
+	setupWasm()
+	if *target_goos != "" {
+		build.Default.GOOS = *target_goos
+	}
+	if *target_goarch != "" {
+		build.Default.GOARCH = *target_goarch
+	}
+	if isCrossBuild() && !*never_run && *remote_target == "" && !*wasm_mode {
+		log.Printf("building for %s/%s, which may not run here, use --no-run or --remote", build.Default.GOOS, build.Default.GOARCH)
+	}
+}
+
+// isCrossBuild reports whether the binaries are built for another
+// platform than the one rerun runs on.
+func isCrossBuild() bool {
+	return build.Default.GOOS != runtime.GOOS || build.Default.GOARCH != runtime.GOARCH
+}
+
+// buildEnv returns the environment of the go commands, or nil when it is
+// rerun's own.
+func buildEnv() (env []string) {
+	if *target_goos != "" {
+		env = append(env, "GOOS="+*target_goos)
+	}
+	if *target_goarch != "" {
+		env = append(env, "GOARCH="+*target_goarch)
+	}
+	env = append(env, build_env...)
+	if len(env) > 0 {
+		env = append(os.Environ(), env...)
+	}
+	return
+}
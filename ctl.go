@@ -0,0 +1,253 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var ctl_enabled = flag.Bool("ctl", false, "Listen for control commands on .rerun/ctl.sock (always on with --vcs-hooks)")
+
+// ctlSocket is where a running rerun listens for control commands,
+// relative to the directory rerun was started in. The commands are HTTP
+// requests, also served under /v1:
+//
+//	POST /trigger?source=<source>               rebuild everything
+//	POST /pause                                 stop reacting to changes
+//	POST /resume                                handle the changes made while paused
+//	POST /args?arg=<arg>&arg=...                restart the programs with other arguments
+//	POST /profile?name=<name>                   switch to a profile, or the next one
+//	GET  /events?kind=<kind>,...&target=<name>  stream events as server-sent events
+var ctlSocket = filepath.Join(".rerun", "ctl.sock")
+
+// the triggers pausing and resuming watching, and the prefix of the one
+// changing the arguments, followed by them as a JSON list.
+const (
+	pauseTrigger  = "ctl:pause"
+	resumeTrigger = "ctl:resume"
+	argsPrefix    = "args:"
+)
+
+// the git hooks that are installed by "rerun ctl install-hooks".
+var vcsHooks = []string{"post-commit", "post-merge", "post-checkout"}
+
+// listenCtl listens on the control socket. For every trigger received, the
+// name of the sender (if given) is sent on triggers.
+func listenCtl() (triggers chan string, err error) {
+	err = os.MkdirAll(filepath.Dir(ctlSocket), 0755)
+	if err != nil {
+		return
+	}
+	// a socket left behind by a previous rerun would make listen fail.
+	os.Remove(ctlSocket)
+
+	l, err := net.Listen("unix", ctlSocket)
+	if err != nil {
+		return
+	}
+
+	triggers = make(chan string)
+	mux := http.NewServeMux()
+	handleCtl(mux, triggers)
+	handleVersioned(mux, "/events", serveEvents)
+	go func() {
+		err := http.Serve(l, mux)
+		log.Printf("error on serving control socket: '%s'\n", err)
+	}()
+	return
+}
+
+// handleCtl adds the control commands to mux, they are sent on triggers.
+func handleCtl(mux *http.ServeMux, triggers chan string) {
+	post := func(path string, trigger func(r *http.Request) string) {
+		handleVersioned(mux, path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				http.Error(w, "use POST", http.StatusMethodNotAllowed)
+				return
+			}
+			triggers <- trigger(r)
+			fmt.Fprintln(w, "ok")
+		})
+	}
+	post("/trigger", func(r *http.Request) string {
+		return r.FormValue("source")
+	})
+	post("/pause", func(r *http.Request) string {
+		return pauseTrigger
+	})
+	post("/resume", func(r *http.Request) string {
+		return resumeTrigger
+	})
+	post("/args", func(r *http.Request) string {
+		r.ParseForm()
+		args, _ := json.Marshal(append([]string{}, r.Form["arg"]...))
+		return argsPrefix + string(args)
+	})
+	post("/profile", func(r *http.Request) string {
+		return profilePrefix + r.FormValue("name")
+	})
+}
+
+// argsCommand returns the arguments of a trigger sent by "rerun ctl args".
+func argsCommand(source string) (args []string, ok bool) {
+	if !strings.HasPrefix(source, argsPrefix) {
+		return
+	}
+	err := json.Unmarshal([]byte(strings.TrimPrefix(source, argsPrefix)), &args)
+	return args, err == nil
+}
+
+// serveEvents streams the events matching the kind and target parameters
+// as server-sent events.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	var kinds []string
+	if kind := r.FormValue("kind"); kind != "" {
+		kinds = strings.Split(kind, ",")
+	}
+	s := subscribe(kinds, r.FormValue("target"))
+	defer unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case ev := <-s.events:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Kind, data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// ctlClient is an http client talking to the control socket.
+var ctlClient = &http.Client{
+	Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", ctlSocket)
+		},
+	},
+}
+
+// ctlURL is the url of a control command, the host is ignored.
+func ctlURL(command string, params url.Values) string {
+	return "http://rerun" + versionPrefix + "/" + command + "?" + params.Encode()
+}
+
+func ctlTrigger(source string) (err error) {
+	return ctlPost("trigger", url.Values{"source": {source}})
+}
+
+// ctlPost sends a control command, and returns the error the running
+// rerun answered with.
+func ctlPost(command string, params url.Values) (err error) {
+	resp, err := ctlClient.PostForm(ctlURL(command, nil), params)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err = errors.New(strings.TrimSpace(string(body)))
+	}
+	return
+}
+
+// ctlEvents prints the events matching the given key=value filters, one
+// JSON object per line.
+func ctlEvents(filters []string) (err error) {
+	params := url.Values{}
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || (kv[0] != "kind" && kv[0] != "target") {
+			return fmt.Errorf("expected kind=<kind>,... or target=<name>, got %q", f)
+		}
+		params.Set(kv[0], kv[1])
+	}
+	resp, err := ctlClient.Get(ctlURL("events", params))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			fmt.Println(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return scanner.Err()
+}
+
+// installHooks writes git hooks that trigger the rerun started in the
+// top level directory of the repository.
+func installHooks() (err error) {
+	out, err := exec.Command("git", "rev-parse", "--git-dir").Output()
+	if err != nil {
+		return
+	}
+	hooksDir := filepath.Join(strings.TrimSpace(string(out)), "hooks")
+
+	for _, hook := range vcsHooks {
+		hookPath := filepath.Join(hooksDir, hook)
+		if _, err = os.Stat(hookPath); err == nil {
+			log.Printf("not overwriting existing hook %s, add 'rerun ctl trigger %s' to it yourself", hookPath, hook)
+			continue
+		}
+		script := fmt.Sprintf("#!/bin/sh\nrerun ctl trigger %s >/dev/null 2>&1 || true\n", hook)
+		err = ioutil.WriteFile(hookPath, []byte(script), 0755)
+		if err != nil {
+			return
+		}
+		log.Printf("installed %s", hookPath)
+	}
+	err = nil
+	return
+}
+
+func ctl(args []string) (err error) {
+	if len(args) < 1 {
+		return errors.New("Usage: rerun ctl trigger|rebuild [source] | pause | resume | args [arg]... | profile [name] | events [kind=<kind>,...] [target=<name>] | install-hooks")
+	}
+
+	switch args[0] {
+	case "install-hooks":
+		err = installHooks()
+	case "trigger", "rebuild":
+		err = ctlTrigger(strings.Join(args[1:], " "))
+	case "pause", "resume":
+		err = ctlPost(args[0], nil)
+	case "args":
+		err = ctlPost("args", url.Values{"arg": args[1:]})
+	case "profile":
+		err = ctlPost("profile", url.Values{"name": {strings.Join(args[1:], " ")}})
+	case "events":
+		err = ctlEvents(args[1:])
+	default:
+		err = fmt.Errorf("unknown ctl command %q", args[0])
+	}
+	return
+}
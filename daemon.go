@@ -0,0 +1,147 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a rerun started with "rerun start" writes its pid and its output, and
+// that of the programs, to these files.
+var (
+	pidFile       = filepath.Join(".rerun", "rerun.pid")
+	daemonLogFile = filepath.Join(".rerun", "rerun.log")
+)
+
+// daemonEnv is set for the rerun started in the background.
+const daemonEnv = "RERUN_DAEMON"
+
+// startDaemon starts rerun in the background with the flags and arguments
+// of the command line, without "start".
+func startDaemon(args []string) (err error) {
+	if pid, running := daemonPid(); running {
+		return fmt.Errorf("rerun is already running in the background with pid %d", pid)
+	}
+	err = os.MkdirAll(filepath.Dir(pidFile), 0755)
+	if err != nil {
+		return
+	}
+	logFile, err := os.OpenFile(daemonLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer logFile.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+	if err != nil {
+		return
+	}
+	log.Printf("started rerun in the background with pid %d, logging to %s", cmd.Process.Pid, daemonLogFile)
+	return
+}
+
+// daemonPid returns the pid of the rerun running in the background, and
+// whether it is still running.
+func daemonPid() (pid int, running bool) {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return
+	}
+	pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return
+	}
+	return pid, processAlive(pid)
+}
+
+// removePidFile removes the pid file when this rerun runs in the
+// background.
+func removePidFile() {
+	if os.Getenv(daemonEnv) != "" {
+		os.Remove(pidFile)
+	}
+}
+
+func stopDaemon() (err error) {
+	pid, running := daemonPid()
+	if !running {
+		os.Remove(pidFile)
+		return errors.New("rerun is not running in the background")
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return
+	}
+	err = terminate(p)
+	if err != nil {
+		return
+	}
+	for i := 0; i < 100 && processAlive(pid); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		return fmt.Errorf("rerun with pid %d did not exit", pid)
+	}
+	os.Remove(pidFile)
+	log.Printf("stopped rerun with pid %d", pid)
+	return
+}
+
+func daemonStatus() {
+	pid, running := daemonPid()
+	if !running {
+		fmt.Println("not running")
+		return
+	}
+	fmt.Printf("running with pid %d, logging to %s\n", pid, daemonLogFile)
+}
+
+// daemonLogs prints the output of the rerun running in the background,
+// and with -f keeps printing what is added to it.
+func daemonLogs(args []string) (err error) {
+	follow := len(args) > 0 && args[0] == "-f"
+	f, err := os.Open(daemonLogFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	for {
+		_, err = io.Copy(os.Stdout, f)
+		if err != nil || !follow {
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// daemonArgs returns the command line without the subcommand.
+func daemonArgs() []string {
+	flags := os.Args[1 : len(os.Args)-flag.NArg()]
+	return append(append([]string{}, flags...), flag.Args()[1:]...)
+}
@@ -0,0 +1,34 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os/exec"
+)
+
+var (
+	debug_mode = flag.Bool("debug", false, "Run the program under a headless delve, restarted on every build, for editor debuggers to attach to")
+	debug_addr = flag.String("debug-addr", "localhost:2345", "Address delve listens on with --debug")
+)
+
+// debugCommand returns the command running binPath under delve, which
+// starts the program right away and lets any number of clients attach.
+func debugCommand(binPath string, args []string) *exec.Cmd {
+	dlvArgs := []string{"exec", "--headless", "--listen=" + *debug_addr, "--accept-multiclient", "--api-version=2", "--continue", binPath}
+	if len(args) > 0 {
+		dlvArgs = append(append(dlvArgs, "--"), args...)
+	}
+	return exec.Command("dlv", dlvArgs...)
+}
+
+// debugBuildFlags keeps the compiler from optimizing, so variables and
+// lines can be inspected in the debugger.
+func debugBuildFlags() []string {
+	if !*debug_mode {
+		return nil
+	}
+	return []string{"-gcflags=all=-N -l"}
+}
@@ -0,0 +1,42 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"github.com/ccll/rerun/pkg/rerun"
+	"time"
+)
+
+var (
+	rebuild_delay = flag.Duration("delay", 0, "Wait this long after changes settled before building, for generators writing several files")
+	start_delay   = flag.Duration("start-delay", 0, "Wait this long before starting the program")
+)
+
+// delayChanges waits for --delay, and returns changed with the changes
+// of source files meanwhile.
+func delayChanges(watcher rerun.Watcher, isSource func(name string) bool, changed []rerun.Change) []rerun.Change {
+	if *rebuild_delay <= 0 {
+		return changed
+	}
+	timeout := time.After(*rebuild_delay)
+	for {
+		select {
+		case c := <-watcher.Events():
+			if isSource(c.Name) {
+				changed = append(changed, c)
+			}
+		case <-timeout:
+			return changed
+		}
+	}
+}
+
+// waitStartDelay waits for --start-delay before the program is started.
+func waitStartDelay() {
+	if *start_delay > 0 {
+		time.Sleep(*start_delay)
+	}
+}
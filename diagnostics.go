@@ -0,0 +1,152 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var error_file = flag.String("errorfile", "", "Write compile errors to this file in file:line:col: message form (vim quickfix)")
+
+// a diagnostic is a single error reported by the go tool, like
+//
+//	./main.go:12:5: undefined: foo
+type diagnostic struct {
+	Package string
+	File    string
+	Line    int
+	Col     int
+	Msg     string
+}
+
+var diagnosticRE = regexp.MustCompile(`^(.+\.(?:go|c|h|s)):(\d+)(?::(\d+))?: (.*)$`)
+
+func (d diagnostic) String() string {
+	if d.Col > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Col, d.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Msg)
+}
+
+// parseDiagnostics splits the output of the go tool into diagnostics and
+// the lines it could not make sense of. Duplicate diagnostics, which the
+// go tool reports e.g. when a package is compiled for tests as well, are
+// dropped.
+func parseDiagnostics(output string) (diags []diagnostic, other []string) {
+	seen := map[diagnostic]bool{}
+	pkg := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		// the go tool starts the errors of every package with "# <import path>"
+		if strings.HasPrefix(line, "# ") {
+			pkg = strings.TrimPrefix(line, "# ")
+			continue
+		}
+		m := diagnosticRE.FindStringSubmatch(line)
+		if m == nil {
+			// continuation lines (like "have (int)\n\twant (string)") belong
+			// to the previous diagnostic.
+			if len(diags) > 0 && strings.HasPrefix(line, "\t") {
+				diags[len(diags)-1].Msg += "\n" + line
+				continue
+			}
+			other = append(other, line)
+			continue
+		}
+		d := diagnostic{Package: pkg, File: m[1], Msg: m[4]}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Col, _ = strconv.Atoi(m[3])
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		diags = append(diags, d)
+	}
+	return
+}
+
+// isTerminal reports whether f is a terminal, in which case it is safe
+// to write escape sequences to it.
+func isTerminal(f *os.File) bool {
+	fi, err := originalFile(f).Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// isTerminalWriter reports whether w is a terminal.
+func isTerminalWriter(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// the first error of the last failed build, for the history.
+var firstError string
+
+// reportBuildOutput prints the output of a failed go command, with the
+// first error highlighted, and updates the error file.
+func reportBuildOutput(output string) {
+	diags, other := parseDiagnostics(output)
+	firstError = ""
+	if len(diags) > 0 {
+		firstError = diags[0].String()
+	} else if len(other) > 0 {
+		firstError = other[0]
+	}
+
+	for _, line := range other {
+		fmt.Println(line)
+	}
+	switch {
+	case previousErrors != nil && len(diags) > 0 && !*all_errors:
+		printErrorDiff(diags)
+	case len(diags) > groupErrorsAbove && !*all_errors:
+		printGroupedDiagnostics(diags)
+	default:
+		for i, d := range diags {
+			if i == 0 && isTerminal(os.Stdout) {
+				fmt.Printf("\x1b[1;31m%s\x1b[0m\n", d)
+				continue
+			}
+			fmt.Println(d)
+		}
+	}
+
+	printHints(suggestFixes(output, diags))
+	writeErrorFile(diags)
+
+	if len(diags) > 0 {
+		previousErrors = diags
+		openEditor(diags[0].File, diags[0].Line, diags[0].Col)
+	}
+}
+
+// writeErrorFile writes diags to the file given with --errorfile, with
+// absolute paths so it can be loaded from any directory. Passing no
+// diagnostics empties the file, so editors don't show stale errors.
+func writeErrorFile(diags []diagnostic) {
+	if *error_file == "" {
+		return
+	}
+	buf := bytes.NewBuffer([]byte{})
+	for _, d := range diags {
+		if abs, err := filepath.Abs(d.File); err == nil {
+			d.File = abs
+		}
+		// quickfix entries are a single line each.
+		d.Msg = strings.Replace(d.Msg, "\n", " ", -1)
+		fmt.Fprintln(buf, d)
+	}
+	ioutil.WriteFile(*error_file, buf.Bytes(), 0644)
+}
@@ -0,0 +1,82 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"go/build"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var test_in_docker = flag.String("test-in-docker", "", "Run the tests inside a container of this docker image")
+
+// the GOPATH workspace inside the test container.
+const dockerGopath = "/go"
+
+// the module of the program inside the test container, with the module
+// cache of the host in the GOPATH.
+const dockerModule = "/src"
+
+// dockerTestCommand wraps the go command line in a docker run of the
+// --test-in-docker image. The module of buildpath is mounted along with
+// the module cache, or its GOPATH workspace as the container's GOPATH,
+// and the build cache is kept in a docker volume so it survives between
+// runs.
+func dockerTestCommand(buildpath string, goargs []string) (cmd *exec.Cmd, err error) {
+	pkg, err := build.Import(buildpath, "", build.FindOnly)
+	if err != nil {
+		return
+	}
+
+	cmdline := []string{"docker", "run", "--rm",
+		"-v", "rerun-go-build-cache:/root/.cache/go-build",
+		"-e", "GOCACHE=/root/.cache/go-build",
+	}
+	if root := findModuleRoot(pkg.Dir); root != "" {
+		var rel, modcache string
+		rel, err = filepath.Rel(root, pkg.Dir)
+		if err != nil {
+			return
+		}
+		modcache, err = goEnv("GOMODCACHE")
+		if err != nil {
+			return
+		}
+		cmdline = append(cmdline,
+			"-v", root+":"+dockerModule,
+			"-v", modcache+":"+path.Join(dockerGopath, "pkg", "mod"),
+			"-e", "GOMODCACHE="+path.Join(dockerGopath, "pkg", "mod"),
+			"-w", path.Join(dockerModule, filepath.ToSlash(rel)),
+		)
+	} else if pkg.Root != "" {
+		cmdline = append(cmdline,
+			"-v", pkg.Root+":"+dockerGopath,
+			"-e", "GOPATH="+dockerGopath,
+			"-e", "GO111MODULE=off",
+			"-w", path.Join(dockerGopath, "src", pkg.ImportPath),
+		)
+	} else {
+		err = errors.New("can only test packages of a module or a GOPATH workspace in docker")
+		return
+	}
+	cmdline = append(cmdline, *test_in_docker, "go")
+	cmdline = append(cmdline, goargs...)
+
+	cmd = exec.Command(cmdline[0], cmdline[1:]...)
+	return
+}
+
+// goEnv returns the value of the go environment variable name.
+func goEnv(name string) (value string, err error) {
+	out, err := exec.Command("go", "env", name).Output()
+	if err != nil {
+		return
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	docker_container = flag.String("docker-container", "", "Run the program in this running docker container: the binary is built for Linux, copied in with docker cp and the container restarted")
+	docker_path      = flag.String("docker-path", "", "Where the binary goes in --docker-container, /usr/local/bin/<program> by default")
+)
+
+// the directory the Linux binaries for --docker-container are built in.
+var dockerBinDir = filepath.Join(".rerun", "docker")
+
+// runDeployed is like run for programs that run elsewhere: every launch
+// calls deploy, which returns a command following the output of the new
+// instance until the next launch, or nil if there is none.
+func runDeployed(binName, phase string, deploy func() (*exec.Cmd, error)) (runch chan bool) {
+	runch = make(chan bool)
+	go func() {
+		var logs *child
+		for relaunch := range runch {
+			if logs != nil {
+				logs.stop()
+				logs = nil
+			}
+			if !relaunch {
+				continue
+			}
+			done := timePhase(phase)
+			cmd, err := deploy()
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			log.Printf("%s %s", phase, roundDuration(done()))
+			emit(eventRunStart, binName, "")
+			emit(eventState, binName, stateRunning)
+			if cmd == nil {
+				continue
+			}
+
+			cmd.Stdout, cmd.Stderr = withFilter(os.Stdout), withFilter(os.Stderr)
+			logs, err = startChild(binName, cmd, nil)
+			if err != nil {
+				log.Printf("error on following the logs: '%s'\n", err)
+			}
+		}
+	}()
+	return
+}
+
+// runInContainer builds the program for the container on every launch,
+// copies it into the container and restarts it.
+func runInContainer(buildpath, binName string) (runch chan bool) {
+	return runDeployed(binName, "docker", func() (cmd *exec.Cmd, err error) {
+		started, err := deployToContainer(buildpath, binName)
+		if err != nil {
+			return
+		}
+		return exec.Command("docker", "logs", "--follow", "--since", started.Format(time.RFC3339Nano), *docker_container), nil
+	})
+}
+
+// buildForLinux builds a static Linux binary of buildpath for arch.
+func buildForLinux(buildpath, binPath, arch string) (err error) {
+	goargs := []string{"build", "-o", binPath}
+	if *build_tags != "" {
+		goargs = append(goargs, "-tags", *build_tags)
+	}
+	cmd := exec.Command("go", append(goargs, buildpath)...)
+	cmd.Env = append(os.Environ(), build_env...)
+	cmd.Env = append(cmd.Env, "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("building for linux/%s: %s\n%s", arch, err, out)
+	}
+	return
+}
+
+// deployToContainer builds the binary for the container's platform, copies
+// it in and restarts the container. It returns when the container was
+// restarted.
+func deployToContainer(buildpath, binName string) (started time.Time, err error) {
+	arch, err := dockerOutput("version", "--format", "{{.Server.Arch}}")
+	if err != nil {
+		return
+	}
+	binPath := filepath.Join(dockerBinDir, binName)
+	err = buildForLinux(buildpath, binPath, arch)
+	if err != nil {
+		return
+	}
+
+	target := *docker_path
+	if target == "" {
+		target = path.Join("/usr/local/bin", binName)
+	}
+	_, err = dockerOutput("cp", binPath, *docker_container+":"+target)
+	if err != nil {
+		return
+	}
+	started = time.Now()
+	_, err = dockerOutput("restart", "--time", "5", *docker_container)
+	return
+}
+
+func dockerOutput(args ...string) (out string, err error) {
+	cmd := exec.Command("docker", args...)
+	stderr := bytes.NewBuffer([]byte{})
+	cmd.Stderr = stderr
+	b, err := cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("docker %s: %s: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return strings.TrimSpace(string(b)), err
+}
@@ -0,0 +1,44 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var open_editor = flag.String("open-editor", "", "Command to open an editor at the first compile error or panic, e.g. \"code -g {file}:{line}:{col}\"")
+
+// openEditor runs the --open-editor command for the given location.
+func openEditor(file string, line, col int) {
+	if *open_editor == "" {
+		return
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	if col == 0 {
+		col = 1
+	}
+	r := strings.NewReplacer("{file}", file, "{line}", strconv.Itoa(line), "{col}", strconv.Itoa(col))
+
+	cmdline := strings.Fields(*open_editor)
+	for i := range cmdline {
+		cmdline[i] = r.Replace(cmdline[i])
+	}
+
+	cmd := exec.Command(cmdline[0], cmdline[1:]...)
+	err := cmd.Start()
+	if err != nil {
+		log.Printf("error on starting editor: '%s'\n", err)
+		return
+	}
+	// don't leave a zombie behind once the editor command is done.
+	go cmd.Wait()
+}
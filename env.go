@@ -0,0 +1,69 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	env_vars stringList
+	env_file = flag.String("env-file", "", "Put the variables of this .env file into the program's environment, restarting it when the file changes")
+)
+
+func init() {
+	flag.Var(&env_vars, "env", "Put KEY=VALUE into the program's environment (repeatable)")
+}
+
+// userEnv returns the variables of --env-file and --env, the latter
+// taking precedence.
+func userEnv() (env []string, err error) {
+	if *env_file != "" {
+		var data []byte
+		data, err = ioutil.ReadFile(*env_file)
+		if err != nil {
+			err = fmt.Errorf("reading env file: %s", err)
+			return
+		}
+		env = parseDotenv(data)
+	}
+	for _, kv := range env_vars {
+		if !strings.Contains(kv, "=") {
+			err = fmt.Errorf("expected --env=KEY=VALUE, got %q", kv)
+			return
+		}
+		env = append(env, kv)
+	}
+	return
+}
+
+// envFilePath is the absolute path of --env-file, or "" without one.
+func envFilePath() string {
+	if *env_file == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(*env_file)
+	if err != nil {
+		return *env_file
+	}
+	return abs
+}
+
+// withoutEnvFile splits the env file off the changed files.
+func withoutEnvFile(changed []string) (rest []string, envChanged bool) {
+	envPath := envFilePath()
+	for _, name := range changed {
+		if envPath != "" && name == envPath {
+			envChanged = true
+			continue
+		}
+		rest = append(rest, name)
+	}
+	return
+}
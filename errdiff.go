@@ -0,0 +1,79 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// the errors of the previous build, nil when it succeeded.
+var previousErrors []diagnostic
+
+// an errorKey identifies an error across builds. Lines move while
+// editing, so they are left out.
+type errorKey struct {
+	file, msg string
+}
+
+func keyOf(d diagnostic) errorKey {
+	return errorKey{d.File, d.Msg}
+}
+
+// diffErrors returns the errors in diags that were not in prev, and
+// those in prev that are not in diags anymore.
+func diffErrors(prev, diags []diagnostic) (added, fixed []diagnostic) {
+	count := map[errorKey]int{}
+	for _, d := range prev {
+		count[keyOf(d)]++
+	}
+	for _, d := range diags {
+		if count[keyOf(d)] > 0 {
+			count[keyOf(d)]--
+			continue
+		}
+		added = append(added, d)
+	}
+	for i := len(prev) - 1; i >= 0; i-- {
+		if count[keyOf(prev[i])] > 0 {
+			count[keyOf(prev[i])]--
+			fixed = append([]diagnostic{prev[i]}, fixed...)
+		}
+	}
+	return
+}
+
+// printErrorDiff prints which errors are new and which were fixed since
+// the previous build, instead of all of them again.
+func printErrorDiff(diags []diagnostic) {
+	added, fixed := diffErrors(previousErrors, diags)
+	fmt.Printf("%d errors: %d new, %d fixed, %d unchanged\n", len(diags), len(added), len(fixed), len(diags)-len(added))
+
+	color := isTerminal(os.Stdout)
+	for _, d := range fixed {
+		if color {
+			fmt.Printf("\x1b[32mfixed: %s\x1b[0m\n", d)
+		} else {
+			fmt.Printf("fixed: %s\n", d)
+		}
+	}
+	for i, d := range added {
+		if color && i == 0 {
+			fmt.Printf("\x1b[1;31mnew: %s\x1b[0m\n", d)
+		} else {
+			fmt.Printf("new: %s\n", d)
+		}
+	}
+	if len(added) == 0 {
+		// remind of where to go on.
+		fmt.Printf("first: %s\n", diags[0])
+	}
+}
+
+// buildSucceeded forgets the errors of previous builds.
+func buildSucceeded() {
+	writeErrorFile(nil)
+	previousErrors = nil
+}
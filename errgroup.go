@@ -0,0 +1,126 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var all_errors = flag.Bool("all-errors", false, "Print every compile error instead of grouping them when there are many")
+
+// with more errors than this, they are grouped.
+const groupErrorsAbove = 10
+
+// the full list of errors of the last build that had them grouped.
+var lastErrorsPath = filepath.Join(".rerun", "last-errors.txt")
+
+// errorKindRE finds the kind of an error, the part of the message that
+// doesn't name anything: "undefined" in "undefined: Foo".
+var errorKindRE = regexp.MustCompile(`^([^:]+):`)
+
+// an errorGroup is a message and how often it was reported.
+type errorGroup struct {
+	msg   string
+	count int
+}
+
+// groupDiagnostics groups diags by package, and within each by message,
+// the most frequent first.
+func groupDiagnostics(diags []diagnostic) (pkgs []string, groups map[string][]*errorGroup) {
+	groups = map[string][]*errorGroup{}
+	byMsg := map[string]*errorGroup{}
+	for _, d := range diags {
+		msg := strings.SplitN(d.Msg, "\n", 2)[0]
+		key := d.Package + "\x00" + msg
+		g := byMsg[key]
+		if g == nil {
+			if groups[d.Package] == nil {
+				pkgs = append(pkgs, d.Package)
+			}
+			g = &errorGroup{msg: msg}
+			byMsg[key] = g
+			groups[d.Package] = append(groups[d.Package], g)
+		}
+		g.count++
+	}
+	for _, pkg := range pkgs {
+		sort.SliceStable(groups[pkg], func(i, j int) bool {
+			return groups[pkg][i].count > groups[pkg][j].count
+		})
+	}
+	return
+}
+
+// errorKinds counts the errors of each kind, like "undefined × 17".
+func errorKinds(diags []diagnostic) string {
+	counts := map[string]int{}
+	var kinds []string
+	for _, d := range diags {
+		kind := d.Msg
+		if m := errorKindRE.FindStringSubmatch(d.Msg); m != nil {
+			kind = m[1]
+		}
+		if counts[kind] == 0 {
+			kinds = append(kinds, kind)
+		}
+		counts[kind]++
+	}
+	sort.SliceStable(kinds, func(i, j int) bool {
+		return counts[kinds[i]] > counts[kinds[j]]
+	})
+	var parts []string
+	for _, kind := range kinds {
+		if counts[kind] > 1 {
+			parts = append(parts, fmt.Sprintf("%s × %d", kind, counts[kind]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printGroupedDiagnostics prints the counts of the errors by package and
+// message, and the first error in full. All errors are written to
+// lastErrorsPath.
+func printGroupedDiagnostics(diags []diagnostic) {
+	pkgs, groups := groupDiagnostics(diags)
+	fmt.Printf("%d errors in %d packages", len(diags), len(pkgs))
+	if kinds := errorKinds(diags); kinds != "" {
+		fmt.Printf(" (%s)", kinds)
+	}
+	fmt.Println()
+	for _, pkg := range pkgs {
+		if pkg != "" {
+			fmt.Printf("# %s\n", pkg)
+		}
+		for _, g := range groups[pkg] {
+			if g.count > 1 {
+				fmt.Printf("\t%s × %d\n", g.msg, g.count)
+			} else {
+				fmt.Printf("\t%s\n", g.msg)
+			}
+		}
+	}
+
+	first := diags[0].String()
+	if isTerminal(os.Stdout) {
+		first = "\x1b[1;31m" + first + "\x1b[0m"
+	}
+	fmt.Println(first)
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, d := range diags {
+		fmt.Fprintln(buf, d)
+	}
+	if os.MkdirAll(filepath.Dir(lastErrorsPath), 0755) == nil && ioutil.WriteFile(lastErrorsPath, buf.Bytes(), 0644) == nil {
+		fmt.Printf("all errors are in %s, or use --all-errors\n", lastErrorsPath)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path"
+	"sync"
+	"time"
+)
+
+// the kinds of events.
+const (
+	eventChange      = "change"
+	eventBuildStart  = "build_start"
+	eventBuildFailed = "build_failed"
+	eventBuildPassed = "build_passed"
+	eventTestFailed  = "test_failed"
+	eventTestPassed  = "test_passed"
+	eventRunStart    = "run_start"
+	eventRunExit     = "run_exit"
+
+	eventIntegrationFailed = "integration_failed"
+	eventIntegrationPassed = "integration_passed"
+	// the state of a program changed, the message is the new state.
+	eventState = "state"
+)
+
+// the states of a program.
+const (
+	stateBuilding = "building"
+	stateTesting  = "testing"
+	stateRunning  = "running"
+	stateFailed   = "failed"
+	stateExited   = "exited"
+)
+
+// an event is something that happened in the loop, as sent to the
+// subscribers of the control socket.
+type event struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Kind          string    `json:"kind"`
+	Target        string    `json:"target,omitempty"`
+	Message       string    `json:"message,omitempty"`
+}
+
+// a subscription receives the events matching its filters.
+type subscription struct {
+	events chan event
+	// no kinds means all kinds.
+	kinds  map[string]bool
+	target string
+}
+
+func (s *subscription) matches(ev event) bool {
+	if len(s.kinds) > 0 && !s.kinds[ev.Kind] {
+		return false
+	}
+	return s.target == "" || s.target == ev.Target
+}
+
+var subscriptions = struct {
+	sync.Mutex
+	m map[*subscription]bool
+}{m: map[*subscription]bool{}}
+
+// subscribe returns a subscription to the events of the given kinds (all
+// if none are given) and target (all if "").
+func subscribe(kinds []string, target string) (s *subscription) {
+	s = &subscription{
+		events: make(chan event, 64),
+		kinds:  map[string]bool{},
+		target: target,
+	}
+	for _, kind := range kinds {
+		s.kinds[kind] = true
+	}
+	subscriptions.Lock()
+	subscriptions.m[s] = true
+	subscriptions.Unlock()
+	return
+}
+
+func unsubscribe(s *subscription) {
+	subscriptions.Lock()
+	delete(subscriptions.m, s)
+	subscriptions.Unlock()
+}
+
+// emit sends an event to all matching subscriptions. Subscribers that
+// don't keep up miss events rather than holding up the loop.
+func emit(kind, target, message string) {
+	ev := event{SchemaVersion: schemaVersion, Time: time.Now(), Kind: kind, Target: target, Message: message}
+	updateStatus(ev)
+	subscriptions.Lock()
+	defer subscriptions.Unlock()
+	for s := range subscriptions.m {
+		if !s.matches(ev) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+		}
+	}
+}
+
+// targetName is how a program shows up in events.
+func targetName(buildpath string) string {
+	return path.Base(buildpath)
+}
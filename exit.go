@@ -0,0 +1,63 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	exit_on_build_error = flag.Bool("exit-on-build-error", false, "Exit with code 1 when building or testing fails, instead of waiting for the next change")
+	exit_with_program   = flag.Bool("exit-with-program", false, "Exit when the program exits by itself, with its exit code")
+)
+
+// the running programs, stopped when rerun exits.
+var liveChildren = struct {
+	sync.Mutex
+	m map[*child]bool
+}{m: map[*child]bool{}}
+
+// exitRerun stops all programs and exits with code.
+func exitRerun(code int) {
+	stopAll()
+	restoreTerminal()
+	unlockPorts()
+	removePidFile()
+	stopCompose()
+	printPhaseSummary()
+	if code != 0 {
+		log.Printf("exiting with code %d", code)
+	}
+	os.Exit(code)
+}
+
+// handleSignals exits cleanly on ^C or SIGTERM.
+func handleSignals() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		exitRerun(1)
+	}()
+}
+
+// stopAll stops all running programs.
+func stopAll() {
+	liveChildren.Lock()
+	var children []*child
+	for c := range liveChildren.m {
+		children = append(children, c)
+	}
+	liveChildren.Unlock()
+
+	for _, c := range children {
+		c.stop()
+	}
+}
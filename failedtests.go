@@ -0,0 +1,43 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// the directory the tests that failed in the last run are kept in, by
+// target.
+var failedTestsDir = filepath.Join(".rerun", "failed-tests")
+
+func failedTestsFile(buildpath string) string {
+	return filepath.Join(failedTestsDir, targetName(buildpath)+".json")
+}
+
+// loadFailedTests returns the tests of buildpath that failed last time.
+func loadFailedTests(buildpath string) (names []string) {
+	data, err := ioutil.ReadFile(failedTestsFile(buildpath))
+	if err == nil {
+		json.Unmarshal(data, &names)
+	}
+	return
+}
+
+// saveFailedTests remembers the tests of buildpath that failed, for the
+// next run.
+func saveFailedTests(buildpath string, names []string) {
+	file := failedTestsFile(buildpath)
+	if len(names) == 0 {
+		os.Remove(file)
+		return
+	}
+	if err := os.MkdirAll(failedTestsDir, 0755); err == nil {
+		data, _ := json.Marshal(names)
+		ioutil.WriteFile(file, data, 0644)
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"go/build"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the configs of other tools that are read when there is no rerun config,
+// so a project can switch to rerun without rewriting them.
+var foreignConfigs = map[string]func(data []byte) (foreignConfig, error){
+	".air.toml":     readAir,
+	"reflex.conf":   readReflex,
+	".realize.yaml": readRealize,
+}
+
+// the order the foreign configs are looked for in.
+var foreignConfigNames = []string{".air.toml", "reflex.conf", ".realize.yaml"}
+
+// the program arguments from a config of another tool, used when none are
+// given on the command line.
+var configArgs []string
+
+// a foreignConfig is another tool's config translated to rerun settings.
+type foreignConfig struct {
+	settings config
+	// the program arguments.
+	args []string
+	// the options rerun has no equivalent for.
+	unsupported []string
+}
+
+// isForeignConfig reports whether path is the config of another tool.
+func isForeignConfig(path string) bool {
+	return foreignConfigs[filepath.Base(path)] != nil
+}
+
+func readForeignConfig(path string, data []byte) (fc foreignConfig, err error) {
+	return foreignConfigs[filepath.Base(path)](data)
+}
+
+func (fc *foreignConfig) unsupportedf(format string, a ...interface{}) {
+	fc.unsupported = append(fc.unsupported, fmt.Sprintf(format, a...))
+}
+
+// addTarget adds the package in dir as a target.
+func (fc *foreignConfig) addTarget(dir string) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fc.unsupportedf("package %s: %s", dir, err)
+		return
+	}
+	pkg, err := build.ImportDir(abs, build.FindOnly)
+	if err != nil {
+		fc.unsupportedf("package %s: %s", dir, err)
+		return
+	}
+	if build.IsLocalImport(pkg.ImportPath) || strings.HasPrefix(pkg.ImportPath, "_") {
+		fc.unsupportedf("package %s outside of GOPATH", dir)
+		return
+	}
+	fc.settings["target"] = append(fc.settings["target"], pkg.ImportPath)
+}
+
+// goCommand translates a go build, go install or go run command line.
+func (fc *foreignConfig) goCommand(words []string) {
+	if len(words) < 2 || words[0] != "go" || (words[1] != "build" && words[1] != "install" && words[1] != "run") {
+		fc.unsupportedf("command %q", strings.Join(words, " "))
+		return
+	}
+	i := 2
+	for ; i < len(words) && strings.HasPrefix(words[i], "-"); i++ {
+		switch words[i] {
+		case "-race":
+			fc.settings["race"] = []string{"true"}
+		case "-o":
+			// rerun decides where the binary goes.
+			i++
+		default:
+			fc.unsupportedf("go %s flag %s", words[1], words[i])
+		}
+	}
+	dir, rest := ".", words[i:]
+	if len(rest) > 0 && strings.HasSuffix(rest[0], ".go") {
+		dir = filepath.Dir(rest[0])
+		for len(rest) > 0 && strings.HasSuffix(rest[0], ".go") {
+			rest = rest[1:]
+		}
+	} else if len(rest) > 0 {
+		dir, rest = rest[0], rest[1:]
+	}
+	if words[1] == "run" {
+		fc.args = append(fc.args, rest...)
+	} else if len(rest) > 0 {
+		fc.unsupportedf("building several packages: %s", strings.Join(rest, " "))
+	}
+	fc.addTarget(dir)
+}
+
+// readAir translates the .air.toml of air.
+func readAir(data []byte) (fc foreignConfig, err error) {
+	fc.settings = config{}
+	sections, err := parseSections(data)
+	if err != nil {
+		return
+	}
+	for name, section := range sections {
+		if name == "color" || name == "log" {
+			// rerun has its own looks.
+			continue
+		}
+		for key, values := range section {
+			key = strings.TrimPrefix(name+"."+key, ".")
+			switch key {
+			case "build.cmd":
+				fc.goCommand(splitWords(values[0]))
+			case "build.args_bin":
+				fc.args = append(fc.args, values...)
+			case "build.bin", "build.full_bin", "build.include_ext", "build.exclude_dir", "root", "tmp_dir":
+				// where the binary goes and what is watched follow from
+				// the package.
+			default:
+				fc.unsupportedf("%s", key)
+			}
+		}
+	}
+	return
+}
+
+// parseSections parses a TOML file with [section] headers in the subset
+// the rerun config uses. Keys before the first header are in section "".
+func parseSections(data []byte) (sections map[string]config, err error) {
+	sections = map[string]config{"": {}}
+	c := sections[""]
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if sections[name] == nil {
+				sections[name] = config{}
+			}
+			c = sections[name]
+			continue
+		}
+		key, values, err := parseSetting(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err)
+		}
+		c[key] = values
+	}
+	err = scanner.Err()
+	return
+}
+
+// the reflex flags that take a value.
+var reflexValueFlags = map[string]bool{
+	"-r": true, "--regex": true, "-R": true, "--inverse-regex": true,
+	"-g": true, "--glob": true, "-G": true, "--inverse-glob": true,
+	"-d": true, "--decoration": true,
+}
+
+// readReflex translates the reflex.conf of reflex, one command per line.
+func readReflex(data []byte) (fc foreignConfig, err error) {
+	fc.settings = config{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := splitWords(line)
+		for len(words) > 0 && words[0] != "--" {
+			flag, value := words[0], ""
+			if eq := strings.Index(flag, "="); eq > 0 {
+				flag, value = flag[:eq], flag[eq+1:]
+			} else if reflexValueFlags[flag] && len(words) > 1 {
+				value, words = words[1], words[1:]
+			}
+			words = words[1:]
+			switch {
+			case flag == "-s" || flag == "--start-service" || flag == "-d" || flag == "--decoration":
+			case (flag == "-r" || flag == "--regex") && value == `\.go$`:
+			case (flag == "-g" || flag == "--glob") && value == "*.go":
+			case value != "":
+				fc.unsupportedf("%s %s", flag, value)
+			default:
+				fc.unsupportedf("%s", flag)
+			}
+		}
+		if len(words) < 2 {
+			fc.unsupportedf("line %q without a command", line)
+			continue
+		}
+		command := words[1:]
+		if len(command) == 3 && command[0] == "sh" && command[1] == "-c" {
+			command = splitWords(command[2])
+		}
+		fc.goCommand(command)
+	}
+	err = scanner.Err()
+	return
+}
+
+// readRealize translates the .realize.yaml of realize.
+func readRealize(data []byte) (fc foreignConfig, err error) {
+	fc.settings = config{}
+	values, keys, err := flattenYAML(data)
+	if err != nil {
+		return
+	}
+	force := values["settings.legacy.force"] == "true"
+	for _, key := range keys {
+		value := values[key]
+		switch {
+		case key == "settings.legacy.force":
+		case key == "settings.legacy.interval":
+			interval, err := time.ParseDuration(value)
+			if err == nil && interval > 0 && force {
+				fc.settings["poll"] = []string{value}
+			}
+		case strings.HasPrefix(key, "schema."):
+			fc.realizeProject(key, value)
+		default:
+			fc.unsupportedf("%s", key)
+		}
+	}
+	if force && len(fc.settings["poll"]) == 0 {
+		fc.settings["poll"] = []string{rerun.DefaultPollInterval.String()}
+	}
+	return
+}
+
+// realizeProject translates the setting of a project in the realize schema.
+func (fc *foreignConfig) realizeProject(key, value string) {
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) < 3 {
+		fc.unsupportedf("%s", key)
+		return
+	}
+	switch setting := parts[2]; {
+	case setting == "name":
+	case setting == "path":
+		fc.addTarget(value)
+	case setting == "commands.install.status", setting == "commands.run.status":
+		if setting == "commands.run.status" && value != "true" {
+			fc.settings["no-run"] = []string{"true"}
+		}
+	case setting == "commands.build.status":
+		fc.settings["build"] = []string{value}
+	case setting == "commands.test.status":
+		fc.settings["test"] = []string{value}
+	case strings.HasPrefix(setting, "args."):
+		fc.args = append(fc.args, value)
+	case strings.HasPrefix(setting, "watcher."):
+		// rerun watches the packages the program depends on.
+	default:
+		fc.unsupportedf("%s", key)
+	}
+}
+
+// flattenYAML reads the block style subset of YAML realize writes, and
+// returns the scalar values by their dotted path, and the paths in the
+// order they appear in. List items are numbered, like schema.0.args.1.
+func flattenYAML(data []byte) (values map[string]string, keys []string, err error) {
+	type frame struct {
+		indent int
+		path   string
+		// item is set for the items of a list, n counts the items of
+		// the list in a key.
+		item bool
+		n    int
+	}
+	values = map[string]string{}
+	set := func(path, value string) {
+		values[path] = value
+		keys = append(keys, path)
+	}
+	stack := []*frame{{indent: -1}}
+	join := func(path, key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		text := strings.TrimRight(scanner.Text(), " \t")
+		line := strings.TrimLeft(text, " ")
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		indent := len(text) - len(line)
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			for top := stack[len(stack)-1]; top.indent > indent || (top.indent == indent && top.item); top = stack[len(stack)-1] {
+				stack = stack[:len(stack)-1]
+			}
+			list := stack[len(stack)-1]
+			path := join(list.path, strconv.Itoa(list.n))
+			list.n++
+			line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+			if !strings.Contains(line, ": ") && !strings.HasSuffix(line, ":") {
+				set(path, unquoteYAML(line))
+				continue
+			}
+			indent += 2
+			stack = append(stack, &frame{indent: indent, path: path, item: true})
+		}
+
+		for top := stack[len(stack)-1]; top.indent > indent || (top.indent == indent && !top.item); top = stack[len(stack)-1] {
+			stack = stack[:len(stack)-1]
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil, nil, fmt.Errorf("line %d: expected key: value", lineno)
+		}
+		path := join(stack[len(stack)-1].path, strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+		if value == "" {
+			stack = append(stack, &frame{indent: indent, path: path})
+			continue
+		}
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			for i, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					set(join(path, strconv.Itoa(i)), unquoteYAML(item))
+				}
+			}
+			continue
+		}
+		set(path, unquoteYAML(value))
+	}
+	err = scanner.Err()
+	return
+}
+
+func unquoteYAML(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// splitWords splits a command line into words like sh does, for the
+// simple cases: words are separated by blanks and may be quoted.
+func splitWords(s string) (words []string) {
+	var word []rune
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word = append(word, r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word, inWord = append(word, r), true
+		}
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return
+}
+
+// hintForeignConfig points out the config of another tool found in the
+// current directory. It is only used when asked for, as it may set
+// targets and commands.
+func hintForeignConfig() {
+	for _, name := range foreignConfigNames {
+		if _, err := os.Stat(name); err == nil {
+			log.Printf("no %s, ignoring %s: use it with --config=%s, or translate it with rerun init --from=%s", *config_path, name, name, name)
+			return
+		}
+	}
+}
+
+// applyForeignConfig translates the config of another tool and applies
+// it, the options without an equivalent are reported.
+func applyForeignConfig(path string, data []byte) (err error) {
+	fc, err := readForeignConfig(path, data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	sort.Strings(fc.unsupported)
+	for _, option := range fc.unsupported {
+		log.Printf("%s: %s is not supported, ignored", path, option)
+	}
+	configArgs = fc.args
+	err = fc.settings.apply(flag.CommandLine)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return
+}
@@ -0,0 +1,95 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	fuzz_target = flag.String("fuzz", "", "Run this fuzz target for --fuzz-time on every change, e.g. FuzzParse")
+	fuzz_time   = flag.Duration("fuzz-time", 30*time.Second, "How long --fuzz fuzzes on every change")
+	fuzz_pkg    = flag.String("fuzz-pkg", "", "Package with the fuzz target of --fuzz, the program's by default")
+)
+
+// the directory, in a package's directory, holding the corpus of its fuzz
+// targets. The fuzzer adds the crashers it finds there.
+const fuzzCorpusDir = "testdata/fuzz"
+
+// isFuzzCorpus reports whether name is in the corpus of a fuzz target.
+// Changes to it never count as changes to the sources, else every crasher
+// found would start the next round.
+func isFuzzCorpus(name string) bool {
+	return strings.Contains(filepath.ToSlash(name), "/"+fuzzCorpusDir+"/")
+}
+
+// runFuzz runs the --fuzz target for --fuzz-time and reports the crashers
+// it found. Failures don't keep the program from being restarted.
+func runFuzz(buildpath string) {
+	pkg := *fuzz_pkg
+	if pkg == "" {
+		pkg = buildpath
+	}
+	var corpus string
+	if p, err := build.Import(pkg, "", build.FindOnly); err == nil {
+		corpus = filepath.Join(p.Dir, filepath.FromSlash(fuzzCorpusDir), *fuzz_target)
+	}
+	before := corpusFiles(corpus)
+
+	cmdline := []string{"test", "-run=^$", "-fuzz=^" + *fuzz_target + "$", "-fuzztime=" + fuzz_time.String()}
+	if *build_tags != "" {
+		cmdline = append(cmdline, "-tags", *build_tags)
+	}
+	cmd := exec.Command("go", append(cmdline, pkg)...)
+	cmd.Env = buildEnv()
+	logCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		log.Printf("%s found nothing in %s", *fuzz_target, *fuzz_time)
+		return
+	}
+	fmt.Print(string(out))
+
+	var found []string
+	for name := range corpusFiles(corpus) {
+		if !before[name] {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	if len(found) == 0 {
+		log.Printf("fuzzing failed: %s", err)
+		return
+	}
+	fmt.Println(strings.Repeat("=", 72))
+	for _, name := range found {
+		fmt.Printf("NEW CRASHER %s\n", filepath.Join(corpus, name))
+		fmt.Printf("  reproduce with: go test -run='%s/%s' %s\n", *fuzz_target, name, pkg)
+	}
+	fmt.Println(strings.Repeat("=", 72))
+	emit(eventTestFailed, targetName(buildpath), fmt.Sprintf("%s found %d new crasher(s)", *fuzz_target, len(found)))
+}
+
+// corpusFiles returns the names of the files in the corpus directory dir.
+func corpusFiles(dir string) (names map[string]bool) {
+	names = map[string]bool{}
+	if dir == "" {
+		return
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	for _, fi := range infos {
+		names[fi.Name()] = true
+	}
+	return
+}
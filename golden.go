@@ -0,0 +1,146 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	golden_dir    = flag.String("golden", "", "Compare the program's output with golden files in this directory")
+	golden_update = flag.Bool("golden-update", false, "Overwrite the golden files with the program's output")
+)
+
+// goldenOutput collects the output of a single run of the program, to be
+// compared with a golden file once the program exits.
+type goldenOutput struct {
+	bytes.Buffer
+	path string
+}
+
+var unsafeNameRE = regexp.MustCompile(`[^A-Za-z0-9._=-]+`)
+
+// newGoldenOutput returns the collector for the run of binName with the
+// given variant of --args-matrix, if any.
+func newGoldenOutput(binName string, variant []string) *goldenOutput {
+	name := binName
+	if len(variant) > 0 {
+		name += "-" + unsafeNameRE.ReplaceAllString(strings.Join(variant, "_"), "_")
+	}
+	return &goldenOutput{path: filepath.Join(*golden_dir, name+".golden")}
+}
+
+// compare diffs the collected output against the golden file. When there
+// is no golden file yet, or with --golden-update, it is written instead.
+func (g *goldenOutput) compare() {
+	want, err := ioutil.ReadFile(g.path)
+	if os.IsNotExist(err) || *golden_update {
+		err = os.MkdirAll(filepath.Dir(g.path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(g.path, g.Bytes(), 0644)
+		}
+		if err != nil {
+			log.Printf("error on writing golden file: '%s'\n", err)
+			return
+		}
+		log.Printf("recorded golden output in %s", g.path)
+		return
+	}
+	if err != nil {
+		log.Printf("error on reading golden file: '%s'\n", err)
+		return
+	}
+
+	if bytes.Equal(want, g.Bytes()) {
+		log.Printf("output matches %s", g.path)
+		return
+	}
+	log.Printf("output differs from %s:", g.path)
+	color := isTerminal(os.Stdout)
+	for _, l := range diffLines(splitLines(string(want)), splitLines(g.String())) {
+		switch {
+		case color && l[0] == '-':
+			fmt.Printf("\x1b[31m%s\x1b[0m\n", l)
+		case color && l[0] == '+':
+			fmt.Printf("\x1b[32m%s\x1b[0m\n", l)
+		default:
+			fmt.Println(l)
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the lines of a diff from a to b, with every line
+// starting with "-", "+" or " ". Unchanged lines far from any change are
+// left out and replaced by "...".
+func diffLines(a, b []string) (diff []string) {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var all []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			all = append(all, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, "-"+a[i])
+			i++
+		default:
+			all = append(all, "+"+b[j])
+			j++
+		}
+	}
+
+	// keep three lines of context around changes, and mark the gaps.
+	const context = 3
+	skipped := false
+	for k, l := range all {
+		near := false
+		for d := k - context; d <= k+context && !near; d++ {
+			near = d >= 0 && d < len(all) && all[d][0] != ' '
+		}
+		if !near {
+			skipped = true
+			continue
+		}
+		if skipped {
+			diff = append(diff, "...")
+			skipped = false
+		}
+		diff = append(diff, l)
+	}
+	return
+}
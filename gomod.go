@@ -0,0 +1,75 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+var (
+	mod_refresh       = flag.String("mod-refresh", "", "Run 'go mod download' or 'go mod tidy' when go.mod changes (download|tidy)")
+	allow_mod_changes = flag.Bool("allow-mod-changes", false, "Let building update go.mod and go.sum, instead of building with -mod=readonly")
+)
+
+// findModuleRoot returns the directory of the go.mod dir belongs to, or
+// "" outside of a module.
+func findModuleRoot(dir string) string {
+	for dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// isModFile reports whether name is a go.mod or go.sum file.
+func isModFile(name string) bool {
+	base := filepath.Base(name)
+	return base == "go.mod" || base == "go.sum"
+}
+
+func hasModFile(names []string) bool {
+	for _, name := range names {
+		if isModFile(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshModules runs the --mod-refresh command in the module at root.
+func refreshModules(root string) (err error) {
+	switch *mod_refresh {
+	case "":
+		return
+	case "download", "tidy":
+	default:
+		return fmt.Errorf("unknown --mod-refresh %q, expected download or tidy", *mod_refresh)
+	}
+
+	log.Printf("go mod %s", *mod_refresh)
+	cmd := exec.Command("go", "mod", *mod_refresh)
+	cmd.Dir = root
+	buf := bytes.NewBuffer([]byte{})
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+
+	err = cmd.Run()
+	if err != nil {
+		fmt.Print(buf.String())
+	}
+	return
+}
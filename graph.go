@@ -0,0 +1,301 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// a depGraph is the set of non-GOROOT packages a program depends on. It is
+// kept up to date by re-importing only the packages that changed.
+type depGraph struct {
+	root string
+	// the directory of the go.mod of root, if any.
+	modRoot string
+	// import path -> package
+	pkgs map[string]*graphPkg
+	// directory -> import path
+	dirs map[string]string
+	// import path -> the error importing it, since the last rebuild or
+	// update.
+	importErrs map[string]error
+}
+
+type graphPkg struct {
+	dir string
+	// the directory of the package importing it, vendored packages are
+	// found from there.
+	srcDir  string
+	imports []string
+	// the directories of files embedded with //go:embed, and the
+	// patterns as absolute globs.
+	embedDirs  []string
+	embedGlobs []string
+	// the C, C++, header and assembly files of the package, by base name,
+	// true for the ones that are part of the build.
+	nativeFiles map[string]bool
+}
+
+// the extensions of files that go build compiles along with .go files.
+var nativeExts = map[string]bool{
+	".c": true, ".h": true, ".s": true, ".S": true,
+	".cc": true, ".cpp": true, ".cxx": true, ".hh": true, ".hpp": true, ".hxx": true,
+}
+
+// isVendored reports whether dir, of a package imported from srcDir, is in
+// a vendor directory go/build resolves imports to: the one of the module,
+// or in a GOPATH workspace the ones of srcDir and its parents below src.
+// Directories merely named vendor elsewhere don't count.
+func (g *depGraph) isVendored(dir, srcDir string) bool {
+	if srcDir == "" {
+		// the program itself.
+		return false
+	}
+	if g.modRoot != "" {
+		return isInside(dir, filepath.Join(g.modRoot, "vendor"))
+	}
+	for _, src := range build.Default.SrcDirs() {
+		for parent := srcDir; isInside(parent, src); parent = filepath.Dir(parent) {
+			if isInside(dir, filepath.Join(parent, "vendor")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isInside reports whether dir is parent or inside of it.
+func isInside(dir, parent string) bool {
+	return dir == parent || strings.HasPrefix(dir, parent+string(filepath.Separator))
+}
+
+func newDepGraph(root string) (g *depGraph) {
+	g = &depGraph{root: root}
+	g.rebuild()
+	return
+}
+
+// rebuild imports all packages from scratch.
+func (g *depGraph) rebuild() {
+	g.pkgs = map[string]*graphPkg{}
+	g.dirs = map[string]string{}
+	g.importErrs = map[string]error{}
+	g.add(g.root, "")
+	if pkg, ok := g.pkgs[g.root]; ok {
+		g.modRoot = findModuleRoot(pkg.dir)
+	}
+}
+
+// add imports importpath, as imported from srcDir, and, recursively, all
+// its imports that are not in the graph yet.
+func (g *depGraph) add(importpath, srcDir string) {
+	pkg, err := build.Import(importpath, srcDir, 0)
+	if pkg.Goroot {
+		return
+	}
+	// "C" is cgo's, not a package.
+	if err != nil && importpath != "C" {
+		g.importErrs[importpath] = err
+	}
+	imports := pkg.Imports
+	// the tests of the program import packages of their own.
+	if *do_tests && importpath == g.root {
+		imports = append(append(append([]string{}, imports...), pkg.TestImports...), pkg.XTestImports...)
+	}
+	gp := &graphPkg{dir: pkg.Dir, srcDir: srcDir, imports: imports, nativeFiles: map[string]bool{}}
+	for _, files := range [][]string{pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.SFiles} {
+		for _, name := range files {
+			gp.nativeFiles[name] = true
+		}
+	}
+	for _, name := range pkg.IgnoredOtherFiles {
+		gp.nativeFiles[name] = false
+	}
+	g.pkgs[importpath] = gp
+	// packages that can't be found have no directory to watch.
+	if pkg.Dir != "" {
+		g.dirs[pkg.Dir] = importpath
+		for _, pattern := range pkg.EmbedPatterns {
+			gp.addEmbed(pkg.Dir, pattern)
+		}
+		for _, dir := range gp.embedDirs {
+			if _, ok := g.dirs[dir]; !ok {
+				g.dirs[dir] = importpath
+			}
+		}
+	}
+	for _, imp := range imports {
+		if _, ok := g.pkgs[imp]; !ok {
+			g.add(imp, pkg.Dir)
+		}
+	}
+}
+
+// update re-imports the packages the changed files belong to, adds
+// packages they now import and drops packages no longer needed.
+func (g *depGraph) update(changed []string) {
+	g.importErrs = map[string]error{}
+	// any package may have moved to another version.
+	if hasModFile(changed) {
+		g.rebuild()
+		return
+	}
+
+	reimport := map[string]bool{}
+	for _, name := range changed {
+		// a package's directory itself was deleted or renamed.
+		importpath, ok := g.dirs[name]
+		if !ok {
+			importpath, ok = g.dirs[filepath.Dir(name)]
+		}
+		if !ok {
+			// a file in a directory we don't know about, start over.
+			g.rebuild()
+			return
+		}
+		reimport[importpath] = true
+	}
+
+	for importpath := range reimport {
+		srcDir := g.pkgs[importpath].srcDir
+		g.remove(importpath)
+		g.add(importpath, srcDir)
+	}
+	g.prune()
+}
+
+// prune drops the packages that are not reachable from the root anymore.
+func (g *depGraph) prune() {
+	reachable := map[string]bool{}
+	var mark func(importpath string)
+	mark = func(importpath string) {
+		pkg, ok := g.pkgs[importpath]
+		if !ok || reachable[importpath] {
+			return
+		}
+		reachable[importpath] = true
+		for _, imp := range pkg.imports {
+			mark(imp)
+		}
+	}
+	mark(g.root)
+
+	for importpath := range g.pkgs {
+		if !reachable[importpath] {
+			g.remove(importpath)
+		}
+	}
+}
+
+// remove drops importpath, but not its imports, from the graph.
+func (g *depGraph) remove(importpath string) {
+	for dir, owner := range g.dirs {
+		if owner == importpath {
+			delete(g.dirs, dir)
+		}
+	}
+	delete(g.pkgs, importpath)
+}
+
+// addEmbed records the files matched by a //go:embed pattern of the
+// package in dir. Embedded directories are embedded with all their
+// subdirectories.
+func (gp *graphPkg) addEmbed(dir, pattern string) {
+	pattern = strings.TrimPrefix(pattern, "all:")
+	glob := filepath.Join(dir, filepath.FromSlash(pattern))
+	gp.embedGlobs = append(gp.embedGlobs, glob)
+
+	matches, _ := filepath.Glob(glob)
+	for _, match := range matches {
+		fi, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		if !fi.IsDir() {
+			gp.embedDirs = append(gp.embedDirs, filepath.Dir(match))
+			continue
+		}
+		filepath.Walk(match, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.IsDir() {
+				gp.embedDirs = append(gp.embedDirs, path)
+			}
+			return nil
+		})
+	}
+}
+
+// isSource reports whether a change to the file name requires a rebuild:
+// it is a .go file, go.mod or go.sum, a C or assembly file of a package,
+// or embedded into a package. Deleting or renaming the directory of a
+// package counts, too.
+func (g *depGraph) isSource(name string) bool {
+	if filepath.Ext(name) == ".go" || isModFile(name) {
+		return true
+	}
+	if _, ok := g.dirs[name]; ok {
+		return true
+	}
+	dir := filepath.Dir(name)
+	for _, pkg := range g.pkgs {
+		if pkg.dir == dir {
+			inBuild, known := pkg.nativeFiles[filepath.Base(name)]
+			// a new file is not in the build info yet.
+			if inBuild || !known && nativeExts[filepath.Ext(name)] {
+				return true
+			}
+		}
+		for _, glob := range pkg.embedGlobs {
+			if ok, _ := filepath.Match(glob, name); ok {
+				return true
+			}
+		}
+		for _, embedDir := range pkg.embedDirs {
+			// a file directly in the package's directory is only embedded
+			// when it matches a glob.
+			if embedDir == dir && dir != pkg.dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contains reports whether any of the changed files belongs to the graph.
+func (g *depGraph) contains(changed []string) bool {
+	for _, name := range changed {
+		dir := filepath.Dir(name)
+		if _, ok := g.dirs[dir]; ok {
+			return true
+		}
+		if _, ok := g.dirs[name]; ok {
+			return true
+		}
+		if isModFile(name) && dir == g.modRoot {
+			return true
+		}
+	}
+	return false
+}
+
+// Dirs returns the directories of all packages in the graph, and the
+// directory of the go.mod. Vendored packages are left out unless
+// --watch-vendor.
+func (g *depGraph) Dirs() (dirs []string) {
+	for dir, importpath := range g.dirs {
+		if !*watch_vendor && g.isVendored(dir, g.pkgs[importpath].srcDir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	if _, ok := g.dirs[g.modRoot]; !ok && g.modRoot != "" {
+		dirs = append(dirs, g.modRoot)
+	}
+	sort.Strings(dirs)
+	return
+}
@@ -0,0 +1,122 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	devices        stringList
+	kernel_modules stringList
+	gpus           = flag.String("gpus", "", "Make only these GPUs visible to the program (sets CUDA_VISIBLE_DEVICES)")
+	device_wait    = flag.Duration("device-wait", 10*time.Second, "How long to wait for a busy --device after a restart")
+)
+
+func init() {
+	flag.Var(&devices, "device", "Device the program needs, checked before every start (repeatable)")
+	flag.Var(&kernel_modules, "kernel-module", "Kernel module the program needs, checked on setup (repeatable)")
+}
+
+// hardwareEnv is the environment the program needs for its hardware.
+func hardwareEnv() (env []string) {
+	if *gpus != "" {
+		env = append(env, "CUDA_VISIBLE_DEVICES="+*gpus)
+	}
+	return
+}
+
+// checkHardware validates that all required kernel modules are loaded and
+// that all required devices exist.
+func checkHardware() (err error) {
+	if len(kernel_modules) > 0 {
+		var loaded map[string]bool
+		loaded, err = loadedKernelModules()
+		if err != nil {
+			return fmt.Errorf("checking kernel modules: %s", err)
+		}
+		for _, mod := range kernel_modules {
+			if !loaded[mod] {
+				return fmt.Errorf("kernel module %q is not loaded, try 'modprobe %s'", mod, mod)
+			}
+		}
+	}
+
+	for _, dev := range devices {
+		_, err = os.Stat(dev)
+		if err != nil {
+			return fmt.Errorf("device %s is not available: %s", dev, err)
+		}
+	}
+	return
+}
+
+func loadedKernelModules() (loaded map[string]bool, err error) {
+	f, err := os.Open("/proc/modules")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	loaded = map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			loaded[fields[0]] = true
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// waitForDevices waits until all required devices can be opened. Devices
+// are often still held for a moment by the previous instance of the
+// program after it was stopped.
+func waitForDevices() {
+	deadline := time.Now().Add(*device_wait)
+	for _, dev := range devices {
+		for {
+			err := openDevice(dev)
+			if err == nil {
+				break
+			}
+			if os.IsPermission(err) {
+				log.Printf("device %s is not usable: %s, check its udev rules or whether you are in its group (e.g. dialout)", dev, err)
+				break
+			}
+			if !isBusy(err) {
+				log.Printf("device %s is not usable: %s", dev, err)
+				break
+			}
+			if time.Now().After(deadline) {
+				log.Printf("device %s is still busy, is another process holding it? (%s)", dev, err)
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func openDevice(dev string) (err error) {
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	return f.Close()
+}
+
+func isBusy(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err == syscall.EBUSY
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"github.com/ccll/rerun/pkg/rerun"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// contentHashes remembers the hashes of the watched source files, to tell
+// real changes from files that were only touched, e.g. by saving without
+// modifications.
+type contentHashes map[string][sha256.Size]byte
+
+// the watched directories are known with this hash, they only change by
+// being deleted or renamed.
+var dirHash [sha256.Size]byte
+
+// addDirs hashes the .go, C, assembly, go.mod and go.sum files in dirs
+// that are not known yet.
+func (h contentHashes) addDirs(dirs []string) {
+	for _, dir := range dirs {
+		if _, ok := h[dir]; !ok && isDir(dir) {
+			h[dir] = dirHash
+		}
+		names, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, name := range names {
+			if _, ok := h[name]; ok {
+				continue
+			}
+			if filepath.Ext(name) != ".go" && !nativeExts[filepath.Ext(name)] && !isModFile(name) {
+				continue
+			}
+			if sum, err := hashFile(name); err == nil {
+				h[name] = sum
+			}
+		}
+	}
+}
+
+// changed returns the names whose content differs from when they were
+// last seen, and remembers their new content.
+func (h contentHashes) changed(names []string) (changed []string) {
+	for _, name := range names {
+		prev, known := h[name]
+		if known && prev == dirHash {
+			if !isDir(name) {
+				delete(h, name)
+				changed = append(changed, name)
+			}
+			continue
+		}
+		sum, err := hashFile(name)
+		switch {
+		case err != nil:
+			// deleted, or not readable anymore.
+			if known {
+				delete(h, name)
+				changed = append(changed, name)
+			}
+			continue
+		case !known || sum != prev:
+			changed = append(changed, name)
+		}
+		h[name] = sum
+	}
+	return
+}
+
+// changes returns the changes of the files whose content differs from
+// when they were last seen, like changed.
+func (h contentHashes) changes(changes []rerun.Change) (changed []rerun.Change) {
+	real := map[string]bool{}
+	for _, name := range h.changed(rerun.Names(changes)) {
+		real[name] = true
+	}
+	for _, c := range changes {
+		if real[c.Name] {
+			changed = append(changed, c)
+		}
+	}
+	return
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+func hashFile(name string) (sum [sha256.Size]byte, err error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	sum = sha256.Sum256(data)
+	return
+}
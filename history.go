@@ -0,0 +1,282 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// every build, test and restart cycle is appended to the history.
+var historyPath = filepath.Join(".rerun", "history.jsonl")
+
+// the session of this rerun, cycles are grouped by it in the stats.
+var sessionID = time.Now().Format(time.RFC3339) + "-" + strconv.Itoa(os.Getpid())
+
+// the files that changed for the current cycle, for the history.
+var cycleChanges []string
+
+// a cycle is a line of the history.
+type cycle struct {
+	SchemaVersion int `json:"schema_version"`
+
+	Session string    `json:"session"`
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target"`
+	Changed []string  `json:"changed,omitempty"`
+	// the durations of the phases in seconds.
+	Durations map[string]float64 `json:"durations"`
+	// passed, build_failed, test_failed or phase_failed.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+func recordCycle(target string, phases phaseLog, result, firstErr string) {
+	c := cycle{
+		SchemaVersion: schemaVersion,
+		Session:       sessionID,
+		Time:          time.Now(),
+		Target:        target,
+		Changed:       cycleChanges,
+		Durations:     map[string]float64{},
+		Result:        result,
+		Error:         firstErr,
+	}
+	for _, p := range phases {
+		c.Durations[p.phase] = p.d.Seconds()
+	}
+	line, _ := json.Marshal(c)
+
+	err := os.MkdirAll(filepath.Dir(historyPath), 0755)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(historyPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("error on writing history: '%s'\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
+
+// readHistory returns the cycles of the last n sessions.
+func readHistory(n int) (cycles []cycle, sessions []string, err error) {
+	f, err := os.Open(historyPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var all []cycle
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c cycle
+		if json.Unmarshal(scanner.Bytes(), &c) != nil {
+			continue
+		}
+		// reruns in several terminals write to the same history.
+		if !seen[c.Session] {
+			seen[c.Session] = true
+			sessions = append(sessions, c.Session)
+		}
+		all = append(all, c)
+	}
+	err = scanner.Err()
+	if len(sessions) > n {
+		sessions = sessions[len(sessions)-n:]
+	}
+	keep := map[string]bool{}
+	for _, s := range sessions {
+		keep[s] = true
+	}
+	for _, c := range all {
+		if keep[c.Session] {
+			cycles = append(cycles, c)
+		}
+	}
+	return
+}
+
+// a summary sums up cycles.
+type summary struct {
+	cycles, buildFailed, testFailed int
+	durations                       map[string][]float64
+	phases                          []string
+}
+
+func (s *summary) add(c cycle) {
+	s.cycles++
+	switch c.Result {
+	case "build_failed":
+		s.buildFailed++
+	case "test_failed":
+		s.testFailed++
+	}
+	if s.durations == nil {
+		s.durations = map[string][]float64{}
+	}
+	for _, phase := range []string{"build", "tests", "go build"} {
+		if d, ok := c.Durations[phase]; ok {
+			if s.durations[phase] == nil {
+				s.phases = append(s.phases, phase)
+			}
+			s.durations[phase] = append(s.durations[phase], d)
+		}
+	}
+}
+
+func (s *summary) failureRate() float64 {
+	return float64(s.buildFailed+s.testFailed) / float64(s.cycles) * 100
+}
+
+func (s *summary) phaseAverages() (out string) {
+	for _, phase := range s.phases {
+		total := 0.0
+		for _, d := range s.durations[phase] {
+			total += d
+		}
+		avg := time.Duration(total / float64(len(s.durations[phase])) * float64(time.Second))
+		out += fmt.Sprintf(", %s avg %s", phase, roundDuration(avg))
+	}
+	return
+}
+
+const statsUsage = "Usage: rerun stats [sessions] | export [--format=csv|json] [sessions]"
+
+// parseSessions returns the number of sessions in args, 10 by default.
+func parseSessions(args []string) (n int, err error) {
+	n = 10
+	if len(args) > 1 {
+		return 0, fmt.Errorf(statsUsage)
+	}
+	if len(args) > 0 {
+		n, err = strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf(statsUsage)
+		}
+	}
+	return
+}
+
+// stats prints build times and failure rates of the last sessions, for
+// "rerun stats [sessions]".
+func stats(args []string) (err error) {
+	if len(args) > 0 && args[0] == "export" {
+		return exportStats(args[1:])
+	}
+	n, err := parseSessions(args)
+	if err != nil {
+		return
+	}
+	cycles, sessions, err := readHistory(n)
+	if os.IsNotExist(err) || len(cycles) == 0 {
+		fmt.Println("no history yet")
+		return nil
+	}
+	if err != nil {
+		return
+	}
+
+	var total summary
+	bySession := map[string]*summary{}
+	for _, c := range cycles {
+		total.add(c)
+		if bySession[c.Session] == nil {
+			bySession[c.Session] = &summary{}
+		}
+		bySession[c.Session].add(c)
+	}
+
+	for _, session := range sessions {
+		s := bySession[session]
+		fmt.Printf("%s: %d cycles, %.0f%% failed%s\n", session, s.cycles, s.failureRate(), s.phaseAverages())
+	}
+	fmt.Printf("last %d sessions: %d cycles, %d failed builds, %d failed tests (%.0f%%)%s\n",
+		len(sessions), total.cycles, total.buildFailed, total.testFailed, total.failureRate(), total.phaseAverages())
+	return
+}
+
+// exportStats writes the cycles of the last sessions to stdout, for
+// "rerun stats export [--format=csv|json] [sessions]": a JSON array of
+// the lines of the history, or CSV with a column per phase.
+func exportStats(args []string) (err error) {
+	format := "csv"
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		arg := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		if !strings.HasPrefix(arg, "format=") {
+			return fmt.Errorf(statsUsage)
+		}
+		format = strings.TrimPrefix(arg, "format=")
+		args = args[1:]
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown format %q, expected csv or json", format)
+	}
+	n, err := parseSessions(args)
+	if err != nil {
+		return
+	}
+	cycles, _, err := readHistory(n)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if format == "json" {
+		if cycles == nil {
+			cycles = []cycle{}
+		}
+		out := json.NewEncoder(os.Stdout)
+		out.SetIndent("", "  ")
+		return out.Encode(cycles)
+	}
+	return writeCyclesCSV(cycles)
+}
+
+// writeCyclesCSV writes cycles as CSV, the durations in seconds in a
+// column per phase and the changed files separated by spaces.
+func writeCyclesCSV(cycles []cycle) (err error) {
+	seen := map[string]bool{}
+	var phases []string
+	for _, c := range cycles {
+		for phase := range c.Durations {
+			if !seen[phase] {
+				seen[phase] = true
+				phases = append(phases, phase)
+			}
+		}
+	}
+	sort.Strings(phases)
+
+	w := csv.NewWriter(os.Stdout)
+	header := []string{"session", "time", "target", "result", "error", "changed"}
+	for _, phase := range phases {
+		header = append(header, phase+"_seconds")
+	}
+	w.Write(header)
+	for _, c := range cycles {
+		record := []string{c.Session, c.Time.Format(time.RFC3339), c.Target, c.Result, c.Error, strings.Join(c.Changed, " ")}
+		for _, phase := range phases {
+			d, ok := c.Durations[phase]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, strconv.FormatFloat(d, 'f', 3, 64))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,66 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+// the hooks, by the kind of event running them.
+var hooks = map[string]*string{
+	eventChange:      flag.String("on-change", "", "Shell command run when sources change, with the changed files in $RERUN_CHANGED"),
+	eventBuildPassed: flag.String("on-build-success", "", "Shell command run when the program was built"),
+	eventBuildFailed: flag.String("on-build-fail", "", "Shell command run when building the program failed"),
+	eventTestFailed:  flag.String("on-test-fail", "", "Shell command run when the tests failed"),
+	eventRunStart:    flag.String("on-run-start", "", "Shell command run when the program was started, with its pid in $RERUN_PID"),
+	eventRunExit:     flag.String("on-run-exit", "", "Shell command run when the program exited, with how in $RERUN_MESSAGE"),
+}
+
+// startHooks runs the hooks of the events as they happen, one at a time
+// and in order, without holding up the loop.
+func startHooks() {
+	var kinds []string
+	for kind, cmdline := range hooks {
+		if *cmdline != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return
+	}
+	s := subscribe(kinds, "")
+	go func() {
+		for ev := range s.events {
+			runHook(*hooks[ev.Kind], ev)
+		}
+	}()
+}
+
+// runHook runs cmdline for ev, with the details of ev in its environment.
+func runHook(cmdline string, ev event) {
+	cmd := shellCommand(cmdline)
+	cmd.Env = append(os.Environ(),
+		"RERUN_EVENT="+ev.Kind,
+		"RERUN_TARGET="+ev.Target,
+		"RERUN_MESSAGE="+ev.Message,
+		"RERUN_TIME="+ev.Time.Format(time.RFC3339),
+	)
+	switch ev.Kind {
+	case eventChange:
+		cmd.Env = append(cmd.Env, "RERUN_CHANGED="+ev.Message)
+	case eventRunStart:
+		cmd.Env = append(cmd.Env, "RERUN_PID="+ev.Message)
+	}
+	prefix := "[on " + ev.Kind + "] "
+	cmd.Stdout = newPrefixWriter(os.Stdout, prefix)
+	cmd.Stderr = newPrefixWriter(os.Stderr, prefix)
+	err := cmd.Run()
+	if err != nil {
+		log.Printf("error on running the %s hook: '%s'\n", ev.Kind, err)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the config files of the tools rerun init --from translates, by tool.
+var initSources = map[string]string{
+	"air":     ".air.toml",
+	"reflex":  "reflex.conf",
+	"realize": ".realize.yaml",
+}
+
+const initUsage = "Usage: rerun init [--force]\n       rerun init --from=air|reflex|realize|<config file> [--force]\n       rerun init --from=compiledaemon [--force] [CompileDaemon flags]"
+
+// initCmd writes a starter rerun config for the project in the current
+// directory, or one translated from the config of another tool or from the
+// flags of CompileDaemon.
+func initCmd(args []string) (err error) {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fromFlag := fs.String("from", "", "")
+	forceFlag := fs.Bool("force", false, "")
+	// the flags of init come first, those of CompileDaemon follow.
+	n := 0
+	for n < len(args) && strings.HasPrefix(args[n], "-") && args[n] != "--" {
+		name := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(args[n], "-"), "-"), "=", 2)[0]
+		if fs.Lookup(name) == nil {
+			break
+		}
+		if name == "from" && !strings.Contains(args[n], "=") {
+			// -from air
+			n++
+		}
+		n++
+	}
+	if n > len(args) {
+		n = len(args)
+	}
+	err = fs.Parse(args[:n])
+	if err != nil {
+		return fmt.Errorf("%s\n%s", err, initUsage)
+	}
+	if n < len(args) && args[n] == "--" {
+		n++
+	}
+	args = args[n:]
+	from, force := *fromFlag, *forceFlag
+	if isRemoteConfig(*config_path) {
+		return fmt.Errorf("cannot write the remote config %s", *config_path)
+	}
+	if _, err := os.Stat(*config_path); err == nil && !force {
+		return fmt.Errorf("%s exists, overwrite it with --force", *config_path)
+	}
+	if from == "" {
+		if len(args) > 0 {
+			return errors.New(initUsage)
+		}
+		return scaffoldConfig()
+	}
+
+	var fc foreignConfig
+	source := from
+	if from == "compiledaemon" {
+		source = "the flags of CompileDaemon"
+		fc, err = readCompileDaemon(args)
+	} else {
+		if name, ok := initSources[from]; ok {
+			source = name
+		}
+		if !isForeignConfig(source) {
+			return fmt.Errorf("cannot translate %s\n%s", from, initUsage)
+		}
+		var data []byte
+		data, err = ioutil.ReadFile(source)
+		if err == nil {
+			fc, err = readForeignConfig(source, data)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", source, err)
+	}
+
+	err = ioutil.WriteFile(*config_path, fc.rerunConfig(source), 0644)
+	if err != nil {
+		return
+	}
+	log.Printf("wrote %s, translated from %s", *config_path, source)
+	return
+}
+
+// rerunConfig formats fc as a rerun config file. The options without an
+// equivalent are listed in comments.
+func (fc foreignConfig) rerunConfig(source string) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "# translated from %s by rerun init\n", source)
+	sort.Strings(fc.unsupported)
+	if len(fc.unsupported) > 0 {
+		fmt.Fprintf(buf, "#\n# not translated, as rerun has no equivalent:\n")
+		for _, option := range fc.unsupported {
+			fmt.Fprintf(buf, "#   %s\n", option)
+		}
+	}
+	buf.WriteString("\n")
+	settings := config{}
+	for key, values := range fc.settings {
+		settings[key] = values
+	}
+	if len(fc.args) > 0 {
+		settings["arg"] = fc.args
+	}
+	settings.write(buf)
+	return buf.Bytes()
+}
+
+// readCompileDaemon translates the flags of CompileDaemon, like
+//
+//	-directory=./cmd/server -build="go build" -command="./server -port=8080"
+func readCompileDaemon(args []string) (fc foreignConfig, err error) {
+	fc.settings = config{}
+	fs := flag.NewFlagSet("compiledaemon", flag.ContinueOnError)
+	directory := fs.String("directory", ".", "")
+	build := fs.String("build", "go build", "")
+	command := fs.String("command", "", "")
+	polling := fs.Bool("polling", false, "")
+	interval := fs.Int("polling-interval", 100, "")
+	// how CompileDaemon looks and stops the program have rerun
+	// equivalents that need no settings.
+	fs.Bool("color", false, "")
+	fs.String("log-prefix", "", "")
+	fs.Bool("graceful-kill", false, "")
+	fs.Bool("recursive", true, "")
+	fs.String("pattern", "", "")
+	// reported as not translated.
+	var excludeDirs, excludes, includes stringList
+	fs.Var(&excludeDirs, "exclude-dir", "")
+	fs.Var(&excludes, "exclude", "")
+	fs.Var(&includes, "include", "")
+	fs.String("build-dir", "", "")
+	fs.String("run-dir", "", "")
+	fs.Bool("verbose", false, "")
+	fs.SetOutput(ioutil.Discard)
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "directory", "build", "command", "polling", "polling-interval", "color", "log-prefix", "graceful-kill", "recursive":
+		case "pattern":
+			// rerun watches the sources of the program and its dependencies.
+		default:
+			fc.unsupportedf("-%s=%s", f.Name, f.Value)
+		}
+	})
+	if fs.NArg() > 0 {
+		fc.unsupportedf("arguments %s", strings.Join(fs.Args(), " "))
+	}
+
+	words := splitWords(*build)
+	if len(words) == 2 || len(words) > 2 && strings.HasPrefix(words[len(words)-1], "-") {
+		words = append(words, *directory)
+	}
+	fc.goCommand(words)
+	if words := splitWords(*command); len(words) > 1 {
+		fc.args = append(fc.args, words[1:]...)
+	}
+	if *polling {
+		poll := rerun.DefaultPollInterval
+		if *interval > 0 {
+			poll = time.Duration(*interval) * time.Millisecond
+		}
+		fc.settings["poll"] = []string{poll.String()}
+	}
+	return
+}
+
+// the .env files rerun init looks for, in order.
+var initEnvFiles = []string{".env", ".env.local", ".env.development"}
+
+// the directories holding templates that are read at runtime.
+var templateDirNames = map[string]bool{"templates": true, "views": true}
+
+// a projectScan is what rerun init found in a project.
+type projectScan struct {
+	mains        []string
+	envFile      string
+	templateDirs []string
+	// the files with go:generate directives.
+	generators []string
+}
+
+// scanProject looks for the main packages, template directories, .env
+// file and go:generate directives of the project in dir.
+func scanProject(dir string) (ps projectScan, err error) {
+	importpath, err := projectImportPath(dir)
+	if err != nil {
+		return
+	}
+	ps.mains = findMainPackages(dir, importpath)
+	for _, name := range initEnvFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			ps.envFile = name
+			break
+		}
+	}
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := fi.Name()
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			if p != dir && (name == "vendor" || name == "testdata" || name == "node_modules" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if templateDirNames[name] {
+				ps.templateDirs = append(ps.templateDirs, rel)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) == ".go" && hasGenerateDirective(p) {
+			ps.generators = append(ps.generators, rel)
+		}
+		return nil
+	})
+	return
+}
+
+// projectImportPath returns the import path of the package in dir, from
+// the module it belongs to or from its GOPATH workspace.
+func projectImportPath(dir string) (importpath string, err error) {
+	if root := findModuleRoot(dir); root != "" {
+		data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "module" {
+				rel, _ := filepath.Rel(root, dir)
+				return path.Join(strings.Trim(fields[1], `"`), filepath.ToSlash(rel)), nil
+			}
+		}
+		return "", fmt.Errorf("no module path in %s", filepath.Join(root, "go.mod"))
+	}
+	pkg, err := build.ImportDir(dir, build.FindOnly)
+	if err != nil {
+		return
+	}
+	if build.IsLocalImport(pkg.ImportPath) || strings.HasPrefix(pkg.ImportPath, "_") {
+		err = fmt.Errorf("%s is neither in a module nor in a GOPATH workspace", dir)
+		return
+	}
+	importpath = pkg.ImportPath
+	return
+}
+
+func hasGenerateDirective(name string) bool {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "//go:generate ") {
+			return true
+		}
+	}
+	return false
+}
+
+// scaffoldConfig writes a starter config for the project in the current
+// directory, with comments explaining the settings.
+func scaffoldConfig() (err error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	ps, err := scanProject(wd)
+	if err != nil {
+		return
+	}
+	if len(ps.mains) == 0 {
+		return fmt.Errorf("no main package in %s", wd)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "# written by rerun init. Flags given on the command line take precedence.\n\n")
+	if len(ps.mains) == 1 {
+		fmt.Fprintf(buf, "# the program rerun builds and runs.\ntarget = %s\n\n", quoteList(ps.mains))
+	} else {
+		fmt.Fprintf(buf, "# the main packages found, all of them are built and run. Keep those you work on.\ntarget = %s\n\n", quoteList(ps.mains))
+	}
+	fmt.Fprintf(buf, "# rerun watches the sources of the program and of the packages it imports,\n# standard library packages are left out, and vendored ones unless\n# watch-vendor = true\n\n")
+	fmt.Fprintf(buf, "# run the tests before restarting the program.\n# test = true\n\n")
+	fmt.Fprintf(buf, "# the program's arguments.\n# arg = [\"-addr=:8080\"]\n\n")
+	if ps.envFile != "" {
+		fmt.Fprintf(buf, "# the variables of %s are put into the program's environment, it is\n# restarted when they change.\nenv-file = %q\n\n", ps.envFile, ps.envFile)
+	}
+	if len(ps.templateDirs) > 0 {
+		var rules []string
+		for _, dir := range ps.templateDirs {
+			rules = append(rules, dir+"/** -> "+defaultPipeline)
+		}
+		fmt.Fprintf(buf, "# templates are read at runtime, restart the program when they change.\nrule = %s\n\n", quoteList(rules))
+	}
+	if len(ps.generators) > 0 {
+		fmt.Fprintf(buf, "# go:generate directives were found, regenerate when their files change.\n")
+		fmt.Fprintf(buf, "[stage.generate]\ncommand = \"go generate ./...\"\nwhen = %s\nbefore = \"build\"\n", quoteList(ps.generators))
+	}
+
+	err = ioutil.WriteFile(*config_path, append(bytes.TrimRight(buf.Bytes(), "\n"), '\n'), 0644)
+	if err != nil {
+		return
+	}
+	log.Printf("wrote %s for %s", *config_path, strings.Join(ps.mains, ", "))
+	return
+}
@@ -0,0 +1,93 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var instances = flag.Int("instances", 1, "Run this many copies of the program, e.g. for local load testing")
+
+// instanceEnv returns the variables of instance i: its index, and the
+// --port ports moved up by i.
+func instanceEnv(i int) (env []string) {
+	env = append(env, "RERUN_INSTANCE="+strconv.Itoa(i))
+	for _, p := range worktreePorts {
+		eq := strings.Index(p, "=")
+		port, _ := strconv.Atoi(p[eq+1:])
+		env = append(env, p[:eq]+"="+strconv.Itoa(port+i))
+	}
+	return
+}
+
+// runInstances is like run, but every launch runs --instances copies of
+// the program, with their output prefixed by their index.
+func runInstances(binName, binPath string, args []string) (runch chan bool) {
+	runch = make(chan bool)
+	go func() {
+		restart := func() {
+			restartLater(runch)
+		}
+		var procs []*child
+		guards := make([]*portGuard, *instances)
+		for i := range guards {
+			guards[i] = newPortGuard(fmt.Sprintf("%s#%d", binName, i), i)
+		}
+		for relaunch := range runch {
+			for _, proc := range procs {
+				proc.stop()
+			}
+			procs = nil
+			if !relaunch {
+				continue
+			}
+			waitForServices()
+			waitForDevices()
+			waitStartDelay()
+			for i := 0; i < *instances; i++ {
+				proc, err := startInstance(binName, binPath, args, i, guards[i], restart)
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+				supervise(proc, restart)
+				procs = append(procs, proc)
+			}
+			emit(eventRunStart, binName, "")
+			emit(eventState, binName, stateRunning)
+		}
+	}()
+	return
+}
+
+// startInstance starts instance i, restart restarts all of them.
+func startInstance(binName, binPath string, args []string, i int, ports *portGuard, restart func()) (proc *child, err error) {
+	label := fmt.Sprintf("[%s#%d] ", binName, i)
+	ports.wait()
+	stdout, stderr := ports.wrap(newPrefixWriter(os.Stdout, label), newPrefixWriter(os.Stderr, label))
+	stdout, stderr = watchOutput(stdout, stderr, restart)
+	cmd, err := childCommand(binPath, args, nextStdinFixture(), stdout, stderr)
+	if err != nil {
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	// later variables take precedence over earlier ones.
+	cmd.Env = append(cmd.Env, instanceEnv(i)...)
+	log.Print(label, append([]string{binName}, args...))
+	proc, err = startChild(ports.name, cmd, func() {
+		ports.exited(restart)
+	})
+	if err != nil {
+		err = fmt.Errorf("error on starting process: '%s'", err)
+	}
+	return
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+var integration_cmd = flag.String("integration", "", "Shell command running an integration test suite against the program once it is ready, e.g. 'go test ./e2e/... -base-url=$RERUN_URL'")
+
+// a suiteRun is a run of the integration suite against an instance of the
+// program.
+type suiteRun struct {
+	c *child
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	canceled bool
+	// closed once the suite is done, code is its exit code then.
+	done chan bool
+	code int
+}
+
+// startIntegration runs the integration suite against c once it is
+// ready. It returns nil without --integration.
+func startIntegration(c *child) (s *suiteRun) {
+	if *integration_cmd == "" {
+		return
+	}
+	skipIntegration.Lock()
+	skip := skipIntegration.m[c.name]
+	skipIntegration.Unlock()
+	if skip {
+		return
+	}
+	s = &suiteRun{c: c, done: make(chan bool)}
+	go s.run()
+	return
+}
+
+func (s *suiteRun) run() {
+	defer close(s.done)
+	s.code = 1
+	if !s.c.waitReady() {
+		log.Printf("%s is not ready, not running the integration suite", s.c.name)
+		return
+	}
+
+	s.mu.Lock()
+	if s.canceled {
+		s.mu.Unlock()
+		return
+	}
+	s.cmd = shellCommand(*integration_cmd)
+	s.cmd.Env = append(os.Environ(), "RERUN_PID="+strconv.Itoa(s.c.cmd.Process.Pid))
+	if base := baseURL(*ready_url); base != "" {
+		s.cmd.Env = append(s.cmd.Env, "RERUN_URL="+base)
+	}
+	s.cmd.Stdout = newPrefixWriter(os.Stdout, "[integration] ")
+	s.cmd.Stderr = newPrefixWriter(os.Stderr, "[integration] ")
+	done := timePhase("integration")
+	err := s.cmd.Start()
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("error on starting the integration suite: '%s'\n", err)
+		return
+	}
+
+	err = s.cmd.Wait()
+	d := done()
+	s.mu.Lock()
+	canceled := s.canceled
+	s.mu.Unlock()
+	if canceled {
+		return
+	}
+	s.code = exitCode(err)
+	name := s.c.name
+	if err != nil {
+		log.Printf("integration suite failed after %s: %s", roundDuration(d), err)
+		emit(eventIntegrationFailed, name, err.Error())
+		return
+	}
+	log.Printf("integration suite passed in %s", roundDuration(d))
+	emit(eventIntegrationPassed, name, "")
+}
+
+// cancel stops the suite, the program is about to be stopped.
+func (s *suiteRun) cancel() {
+	s.mu.Lock()
+	s.canceled = true
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// baseURL returns the scheme and host of u, "" if it isn't a URL.
+func baseURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
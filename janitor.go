@@ -0,0 +1,63 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var keep_artifacts = flag.Duration("keep-artifacts", 7*24*time.Hour, "Delete cached files and artifacts under .rerun that are older than this")
+
+// artifactPaths are the files and directories under .rerun that rerun can
+// recreate, and that are cleaned up after --keep-artifacts.
+var artifactPaths = []string{configCacheDir, lastPanicPath, lastErrorsPath, dockerBinDir, k8sBuildDir, remoteBinDir, profilesDir, benchDir, coverDir, failedTestsDir}
+
+// how often the janitor looks for old artifacts.
+const janitorInterval = time.Hour
+
+// startJanitor removes old artifacts now and every janitorInterval.
+func startJanitor() {
+	if *keep_artifacts <= 0 {
+		return
+	}
+	go func() {
+		for {
+			removed, freed := cleanArtifacts(*keep_artifacts)
+			if removed > 0 {
+				log.Printf("removed %d old artifacts (%d KiB)", removed, freed/1024)
+			}
+			time.Sleep(janitorInterval)
+		}
+	}()
+}
+
+// cleanArtifacts removes all artifact files older than maxAge, and
+// returns how many were removed and their total size.
+func cleanArtifacts(maxAge time.Duration) (removed int, freed int64) {
+	cutoff := time.Now().Add(-maxAge)
+	for _, root := range artifactPaths {
+		filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() || fi.ModTime().After(cutoff) {
+				return nil
+			}
+			if os.Remove(p) == nil {
+				removed++
+				freed += fi.Size()
+			}
+			return nil
+		})
+	}
+	return
+}
+
+// clean removes all artifacts, for "rerun clean".
+func clean() {
+	removed, freed := cleanArtifacts(0)
+	log.Printf("removed %d artifacts (%d KiB)", removed, freed/1024)
+}
@@ -0,0 +1,96 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	k8s_deploy     = flag.String("k8s-deploy", "", "Run the program in this kubernetes workload, e.g. deployment/api: every build is put into an image, loaded into the cluster and rolled out")
+	k8s_image      = flag.String("k8s-image", "", "Image the --k8s-deploy workload runs, rerun/<program>:dev by default")
+	k8s_load       = flag.String("k8s-load", "kind", "How the image gets into the cluster: kind, minikube or push")
+	k8s_namespace  = flag.String("k8s-namespace", "", "Namespace of --k8s-deploy")
+	k8s_base_image = flag.String("k8s-base-image", "gcr.io/distroless/static-debian12", "Base image the binary is put into for --k8s-deploy")
+)
+
+// the directory the images for --k8s-deploy are built in.
+var k8sBuildDir = filepath.Join(".rerun", "k8s")
+
+// runInCluster builds an image of the program on every launch, loads it
+// into the cluster and restarts the workload, following the logs of the
+// new pods.
+func runInCluster(buildpath, binName string) (runch chan bool) {
+	return runDeployed(binName, "rollout", func() (cmd *exec.Cmd, err error) {
+		err = deployToCluster(buildpath, binName)
+		if err != nil {
+			return
+		}
+		return exec.Command("kubectl", kubectlArgs("logs", "--follow", "--since=1s", "--all-containers", *k8s_deploy)...), nil
+	})
+}
+
+func deployToCluster(buildpath, binName string) (err error) {
+	image := *k8s_image
+	if image == "" {
+		image = "rerun/" + binName + ":dev"
+	}
+	dir := filepath.Join(k8sBuildDir, binName)
+	err = buildForLinux(buildpath, filepath.Join(dir, binName), build.Default.GOARCH)
+	if err != nil {
+		return
+	}
+	dockerfile := fmt.Sprintf("FROM %s\nCOPY %s /%s\nENTRYPOINT [\"/%s\"]\n", *k8s_base_image, binName, binName, binName)
+	err = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644)
+	if err != nil {
+		return
+	}
+	_, err = dockerOutput("build", "--quiet", "--tag", image, dir)
+	if err != nil {
+		return
+	}
+
+	switch *k8s_load {
+	case "kind":
+		err = runTool("kind", "load", "docker-image", image)
+	case "minikube":
+		err = runTool("minikube", "image", "load", image)
+	case "push":
+		_, err = dockerOutput("push", image)
+	default:
+		err = fmt.Errorf("unknown --k8s-load %q, expected kind, minikube or push", *k8s_load)
+	}
+	if err != nil {
+		return
+	}
+
+	err = runTool("kubectl", kubectlArgs("rollout", "restart", *k8s_deploy)...)
+	if err != nil {
+		return
+	}
+	return runTool("kubectl", kubectlArgs("rollout", "status", "--timeout=2m", *k8s_deploy)...)
+}
+
+func kubectlArgs(args ...string) []string {
+	if *k8s_namespace != "" {
+		args = append([]string{"--namespace", *k8s_namespace}, args...)
+	}
+	return args
+}
+
+// runTool runs a command, its output only shows up in the error.
+func runTool(name string, args ...string) (err error) {
+	out, err := runQuiet(name, args...)
+	if err != nil {
+		err = fmt.Errorf("%s %s: %s: %s", name, args[0], err, strings.TrimSpace(out))
+	}
+	return
+}
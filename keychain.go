@@ -0,0 +1,65 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// tokens are kept in the OS keychain under this service, so configs can
+// refer to them by name instead of holding them in plain text.
+const keychainService = "rerun"
+
+var keychainName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func checkKeychainName(name string) error {
+	if !keychainName.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// secretCmd manages the tokens in the keychain. The value to set is read
+// from stdin, so it doesn't end up in the shell history.
+func secretCmd(args []string) (err error) {
+	if len(args) != 2 {
+		return errors.New("Usage: rerun secret set|get|delete <name>")
+	}
+	name := args[1]
+	err = checkKeychainName(name)
+	if err != nil {
+		return
+	}
+
+	switch args[0] {
+	case "set":
+		if isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "value of %s: ", name)
+		}
+		var value string
+		value, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		value = strings.TrimRight(value, "\r\n")
+		if value == "" {
+			return errors.New("no value given")
+		}
+		err = keychainSet(name, value)
+	case "get":
+		var value string
+		value, err = keychainGet(name)
+		if err == nil {
+			fmt.Println(value)
+		}
+	case "delete":
+		err = keychainDelete(name)
+	default:
+		err = fmt.Errorf("unknown secret command %q", args[0])
+	}
+	return
+}
@@ -0,0 +1,35 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// on macOS, tokens are generic passwords in the login keychain.
+
+// keychainSet leaves the value out of the arguments, where any user could
+// see it: with -w last, security prompts for it twice. Without a
+// controlling terminal, it reads the answers from stdin.
+func keychainSet(name, value string) (err error) {
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", keychainService, "-a", name, "-w")
+	cmd.Stdin = strings.NewReader(value + "\n" + value + "\n")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	_, err = runSecretCommand(cmd)
+	return
+}
+
+func keychainGet(name string) (value string, err error) {
+	out, err := secretCommand("security", "find-generic-password", "-s", keychainService, "-a", name, "-w")
+	value = strings.TrimRight(string(out), "\n")
+	return
+}
+
+func keychainDelete(name string) (err error) {
+	_, err = secretCommand("security", "delete-generic-password", "-s", keychainService, "-a", name)
+	return
+}
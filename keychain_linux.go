@@ -0,0 +1,49 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// on Linux, tokens are kept in the user keyring (@u) with keyctl, which is
+// shared by all sessions of the user.
+
+func keychainDesc(name string) string {
+	return keychainService + ":" + name
+}
+
+func keychainSet(name, value string) (err error) {
+	cmd := exec.Command("keyctl", "padd", "user", keychainDesc(name), "@u")
+	cmd.Stdin = strings.NewReader(value)
+	_, err = runSecretCommand(cmd)
+	return
+}
+
+func keychainID(name string) (id string, err error) {
+	out, err := secretCommand("keyctl", "search", "@u", "user", keychainDesc(name))
+	id = strings.TrimSpace(string(out))
+	return
+}
+
+func keychainGet(name string) (value string, err error) {
+	id, err := keychainID(name)
+	if err != nil {
+		return
+	}
+	out, err := secretCommand("keyctl", "pipe", id)
+	value = string(out)
+	return
+}
+
+func keychainDelete(name string) (err error) {
+	id, err := keychainID(name)
+	if err != nil {
+		return
+	}
+	_, err = secretCommand("keyctl", "unlink", id, "@u")
+	return
+}
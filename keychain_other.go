@@ -0,0 +1,26 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+import (
+	"errors"
+)
+
+var errNoKeychain = errors.New("no keychain support on this system")
+
+func keychainSet(name, value string) error {
+	return errNoKeychain
+}
+
+func keychainGet(name string) (string, error) {
+	return "", errNoKeychain
+}
+
+func keychainDelete(name string) error {
+	return errNoKeychain
+}
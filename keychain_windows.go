@@ -0,0 +1,98 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// on Windows, tokens are encrypted for the current user with DPAPI and
+// kept in the user's config directory.
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = kernel32.NewProc("LocalFree")
+)
+
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newDataBlob(b []byte) *dataBlob {
+	if len(b) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(b)), data: &b[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	out := make([]byte, b.size)
+	copy(out, (*[1 << 30]byte)(unsafe.Pointer(b.data))[:b.size:b.size])
+	return out
+}
+
+// dpapi encrypts or decrypts data with proc.
+func dpapi(proc *syscall.LazyProc, data []byte) (out []byte, err error) {
+	var result dataBlob
+	ok, _, e := proc.Call(uintptr(unsafe.Pointer(newDataBlob(data))), 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&result)))
+	if ok == 0 {
+		return nil, e
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(result.data)))
+	return result.bytes(), nil
+}
+
+func keychainPath(name string) (path string, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return
+	}
+	return filepath.Join(dir, keychainService, "keychain", name), nil
+}
+
+func keychainSet(name, value string) (err error) {
+	path, err := keychainPath(name)
+	if err != nil {
+		return
+	}
+	data, err := dpapi(procCryptProtectData, []byte(value))
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func keychainGet(name string) (value string, err error) {
+	path, err := keychainPath(name)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	out, err := dpapi(procCryptUnprotectData, data)
+	value = string(out)
+	return
+}
+
+func keychainDelete(name string) (err error) {
+	path, err := keychainPath(name)
+	if err != nil {
+		return
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,100 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var keys_enabled = flag.Bool("keys", false, "Read key commands from the terminal: r rebuild and restart, p pause/resume watching, P switch to the next profile, t run the tests, q quit")
+
+// key commands arrive on the trigger channel with this prefix.
+const keyPrefix = "key:"
+
+// the terminal settings from before listenKeys, restored on exit.
+var savedTerminal string
+
+// listenKeys switches the terminal to reading single keypresses without
+// echo, and sends every key pressed on triggers.
+func listenKeys(triggers chan string) (err error) {
+	if !isTerminal(os.Stdin) {
+		return errors.New("--keys needs a terminal on stdin")
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return
+	}
+	savedTerminal = strings.TrimSpace(saved)
+	_, err = stty("-icanon", "-echo", "min", "1")
+	if err != nil {
+		return
+	}
+
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				log.Printf("error on reading keys: '%s'\n", err)
+				return
+			}
+			if n == 1 {
+				triggers <- keyPrefix + string(buf[0])
+			}
+		}
+	}()
+	return
+}
+
+func stty(args ...string) (out string, err error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	b, err := cmd.Output()
+	return string(b), err
+}
+
+func restoreTerminal() {
+	if savedTerminal != "" {
+		stty(savedTerminal)
+	}
+}
+
+// keyCommand returns the key of a trigger sent by listenKeys.
+func keyCommand(source string) (key string, ok bool) {
+	if !strings.HasPrefix(source, keyPrefix) {
+		return
+	}
+	return strings.TrimPrefix(source, keyPrefix), true
+}
+
+// handleKey carries out the key commands other than pausing.
+func handleKey(key string, targets []*target) {
+	switch key {
+	case "r":
+		log.Println("rebuilding and restarting")
+		for _, t := range targets {
+			// restart even if the binary is unchanged.
+			delete(runningBinaries, t.buildpath)
+			t.rebuild()
+		}
+	case "P":
+		switchProfile("", targets)
+	case "t":
+		for _, t := range targets {
+			test(t.buildpath)
+		}
+	case "q":
+		log.Println("quitting")
+		exitRerun(0)
+	case "\n":
+	default:
+		log.Println("keys: r rebuild and restart, p pause/resume watching, P switch to the next profile, t run the tests, q quit")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var listen_addrs stringList
+
+func init() {
+	flag.Var(&listen_addrs, "listen", "Open this TCP address, or UDP one as udp://<addr>, and hand the socket to the program as an inherited file descriptor, systemd style, so restarts never drop it (repeatable)")
+}
+
+// the listeners of --listen, opened once and kept open for all runs of
+// the program.
+var listeners struct {
+	once  sync.Once
+	ls    []io.Closer
+	files []*os.File
+	err   error
+}
+
+// listenSocket opens the socket of a --listen address, tcp://<addr> or
+// udp://<addr>, TCP without a scheme.
+func listenSocket(addr string) (socket io.Closer, f *os.File, err error) {
+	if strings.HasPrefix(addr, "udp://") {
+		var conn net.PacketConn
+		conn, err = net.ListenPacket("udp", strings.TrimPrefix(addr, "udp://"))
+		if err != nil {
+			return
+		}
+		socket = conn
+		f, err = conn.(*net.UDPConn).File()
+	} else {
+		var l net.Listener
+		l, err = net.Listen("tcp", strings.TrimPrefix(addr, "tcp://"))
+		if err != nil {
+			return
+		}
+		socket = l
+		f, err = l.(*net.TCPListener).File()
+	}
+	if err != nil {
+		socket.Close()
+		err = fmt.Errorf("error on handing over %s: '%s'", addr, err)
+	}
+	return
+}
+
+func openListeners() (files []*os.File, err error) {
+	listeners.once.Do(func() {
+		for _, addr := range listen_addrs {
+			socket, f, err := listenSocket(addr)
+			if err != nil {
+				listeners.err = err
+				return
+			}
+			listeners.ls = append(listeners.ls, socket)
+			listeners.files = append(listeners.files, f)
+		}
+	})
+	return listeners.files, listeners.err
+}
+
+// withListeners passes the --listen listeners to the program started by
+// cmd as file descriptors 3 and up, in the order given, with LISTEN_FDS
+// and LISTEN_PID set as systemd does. The connections arriving while the
+// program restarts wait in the listener's backlog, the datagrams in the
+// receive buffer of the UDP socket.
+func withListeners(cmd *exec.Cmd) (c *exec.Cmd, err error) {
+	c = cmd
+	if len(listen_addrs) == 0 {
+		return
+	}
+	if runtime.GOOS == "windows" {
+		err = errors.New("--listen is not supported on windows")
+		return
+	}
+	files, err := openListeners()
+	if err != nil {
+		return
+	}
+
+	// LISTEN_PID is the pid of the program, which is only known once it
+	// runs: the shell sets it before turning into the program.
+	c = exec.Command("sh", append([]string{"-c", `LISTEN_PID=$$; export LISTEN_PID; exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)...)
+	c.Dir, c.Stdin, c.Stdout, c.Stderr = cmd.Dir, cmd.Stdin, cmd.Stdout, cmd.Stderr
+	c.Env = cmd.Env
+	if c.Env == nil {
+		c.Env = os.Environ()
+	}
+	c.Env = append(c.Env, "LISTEN_FDS="+strconv.Itoa(len(files)))
+	c.ExtraFiles = files
+	return
+}
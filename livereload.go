@@ -0,0 +1,87 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// reloads the page when rerun says so.
+const reloadScript = `new EventSource("/_rerun/reload").onmessage = () => location.reload();
+`
+
+// the browsers waiting to be reloaded.
+var browserReloads = struct {
+	sync.Mutex
+	m map[chan bool]bool
+}{m: map[chan bool]bool{}}
+
+// handleReload adds the routes of the reload script to mux. Pages
+// including /_rerun/reload.js are reloaded by reloadBrowsers.
+func handleReload(mux *http.ServeMux) {
+	mux.HandleFunc("/_rerun/reload.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript")
+		fmt.Fprint(w, reloadScript)
+	})
+	mux.HandleFunc("/_rerun/reload", serveReload)
+}
+
+// reloadBrowsers reloads the pages waiting in serveReload.
+func reloadBrowsers() {
+	browserReloads.Lock()
+	defer browserReloads.Unlock()
+	for reload := range browserReloads.m {
+		select {
+		case reload <- true:
+		default:
+		}
+	}
+	if n := len(browserReloads.m); n > 0 {
+		log.Printf("reloading %d browser(s)", n)
+	}
+}
+
+// injectReload adds the reload script to the end of the body of page.
+func injectReload(page []byte) []byte {
+	script := []byte(`<script src="/_rerun/reload.js"></script>`)
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		return append(page, script...)
+	}
+	return append(append(append([]byte{}, page[:i]...), script...), page[i:]...)
+}
+
+// serveReload tells the browser to reload once, as a server-sent event.
+func serveReload(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	reload := make(chan bool, 1)
+	browserReloads.Lock()
+	browserReloads.m[reload] = true
+	browserReloads.Unlock()
+	defer func() {
+		browserReloads.Lock()
+		delete(browserReloads.m, reload)
+		browserReloads.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	select {
+	case <-reload:
+		fmt.Fprint(w, "data: reload\n\n")
+		flusher.Flush()
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	log_file     = flag.String("log-file", "", "Also write the program's output to this file, e.g. .rerun/app.log")
+	log_max_size = flag.Int("log-max-size", 10, "Rotate --log-file when it grows beyond this many megabytes")
+	log_keep     = flag.Int("log-keep", 5, "How many rotated --log-file files to keep")
+)
+
+// a rotatingFile is a log file that is moved to <name>.1 when it gets too
+// big, the older ones to <name>.2 and so on.
+type rotatingFile struct {
+	name    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// childLog is the --log-file shared by all programs.
+var childLog *rotatingFile
+
+// withLogFile returns w writing to --log-file as well.
+func withLogFile(w io.Writer) io.Writer {
+	if *log_file == "" {
+		return w
+	}
+	if childLog == nil {
+		childLog = &rotatingFile{name: *log_file, maxSize: int64(*log_max_size) << 20, keep: *log_keep}
+	}
+	return io.MultiWriter(w, childLog)
+}
+
+// Write never fails, so the program's output still reaches the terminal
+// when the log file can't be written.
+func (r *rotatingFile) Write(b []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil && r.size+int64(len(b)) > r.maxSize {
+		r.f.Close()
+		r.f = nil
+		r.rotate()
+	}
+	if r.f == nil {
+		r.f, err = r.open()
+		if err != nil {
+			log.Printf("error on opening log file: '%s'\n", err)
+			return len(b), nil
+		}
+	}
+	n, err = r.f.Write(b)
+	r.size += int64(n)
+	return len(b), nil
+}
+
+func (r *rotatingFile) open() (f *os.File, err error) {
+	err = os.MkdirAll(filepath.Dir(r.name), 0755)
+	if err != nil {
+		return
+	}
+	f, err = os.OpenFile(r.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.size = fi.Size()
+	return
+}
+
+// rotate moves the log file to <name>.1, dropping the oldest one.
+func (r *rotatingFile) rotate() {
+	rotated := func(i int) string {
+		return fmt.Sprintf("%s.%d", r.name, i)
+	}
+	os.Remove(rotated(r.keep))
+	for i := r.keep - 1; i >= 1; i-- {
+		os.Rename(rotated(i), rotated(i+1))
+	}
+	if r.keep > 0 {
+		os.Rename(r.name, rotated(1))
+	} else {
+		os.Remove(r.name)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var main_package = flag.String("main", "", "Main package to run when the import path holds several, e.g. cmd/api")
+
+// the main packages picked for import paths that hold several, so the
+// question is only asked once per project.
+var mainChoicesPath = filepath.Join(".rerun", "main-packages.json")
+
+// resolveMain returns buildpath if it is a main package. Otherwise it
+// looks for main packages below it and picks the one given with --main,
+// the only one, the one picked before or asks which one to use.
+func resolveMain(buildpath string) (mainpath string, err error) {
+	pkg, err := build.Import(buildpath, "", 0)
+	if err == nil && pkg.Name == "main" {
+		mainpath = buildpath
+		return
+	}
+	// leave other problems to setup, they may be fixed while rerun runs.
+	mainpath = buildpath
+	if _, ok := err.(*build.NoGoError); err != nil && !ok {
+		err = nil
+		return
+	}
+
+	candidates := findMainPackages(pkg.Dir, pkg.ImportPath)
+	switch {
+	case len(candidates) == 0:
+		err = nil
+		return
+	case len(candidates) == 1:
+		mainpath = candidates[0]
+		log.Printf("using main package %s", mainpath)
+		return
+	}
+
+	if *main_package != "" {
+		for _, c := range candidates {
+			if c == *main_package || strings.HasSuffix(c, "/"+strings.Trim(*main_package, "/")) {
+				mainpath = c
+				return
+			}
+		}
+		err = fmt.Errorf("no main package %s in %s", *main_package, buildpath)
+		return
+	}
+
+	choices := map[string]string{}
+	if data, err := ioutil.ReadFile(mainChoicesPath); err == nil {
+		json.Unmarshal(data, &choices)
+	}
+	for _, c := range candidates {
+		if choices[buildpath] == c {
+			mainpath = c
+			log.Printf("using main package %s, as picked before", mainpath)
+			return
+		}
+	}
+
+	mainpath, err = askMain(buildpath, candidates)
+	if err != nil {
+		return
+	}
+	choices[buildpath] = mainpath
+	if data, err := json.MarshalIndent(choices, "", "\t"); err == nil {
+		os.MkdirAll(filepath.Dir(mainChoicesPath), 0755)
+		ioutil.WriteFile(mainChoicesPath, data, 0644)
+	}
+	return
+}
+
+// findMainPackages returns the import paths of all main packages in and
+// below dir, which holds the package importpath.
+func findMainPackages(dir, importpath string) (mains []string) {
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		name := fi.Name()
+		// the go tool ignores these directories as well.
+		if p != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		pkg, err := build.ImportDir(p, 0)
+		if err != nil || pkg.Name != "main" {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		mains = append(mains, path.Join(importpath, filepath.ToSlash(rel)))
+		return nil
+	})
+	return
+}
+
+// askMain lets the user pick one of the candidates on the terminal.
+func askMain(buildpath string, candidates []string) (mainpath string, err error) {
+	if !isTerminal(os.Stdin) {
+		err = fmt.Errorf("%s holds several main packages, pick one with --main: %s", buildpath, strings.Join(candidates, ", "))
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s holds several main packages:\n", buildpath)
+	for i, c := range candidates {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, c)
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "which one should be run? [1-%d] ", len(candidates))
+		var line string
+		line, err = in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, convErr := strconv.Atoi(strings.TrimSpace(line))
+		if convErr == nil && n >= 1 && n <= len(candidates) {
+			mainpath = candidates[n-1]
+			return
+		}
+	}
+}
+
+// uniqueTargets drops the programs given more than once, e.g. both on the
+// command line and as a target of the config, by their directory.
+func uniqueTargets(buildpaths []string) (unique []string) {
+	seen := map[string]bool{}
+	for _, buildpath := range buildpaths {
+		key := buildpath
+		if pkg, err := build.Import(buildpath, "", build.FindOnly); err == nil && pkg.Dir != "" {
+			key = pkg.Dir
+		}
+		if seen[key] {
+			infof("%s is given more than once, running it once", buildpath)
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, buildpath)
+	}
+	return
+}
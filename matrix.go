@@ -0,0 +1,148 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	args_matrix          = flag.String("args-matrix", "", "JSON list of argument sets, the program is run once with each of them, e.g. '[\"--mode=a\",\"--mode=b\"]'")
+	args_matrix_parallel = flag.Bool("args-matrix-parallel", false, "Run all --args-matrix variants at the same time")
+)
+
+// argsMatrix parses --args-matrix. Every entry is either a string, which is
+// split at white space, or a list of arguments.
+func argsMatrix() (variants [][]string, err error) {
+	if *args_matrix == "" {
+		return
+	}
+	var entries []json.RawMessage
+	err = json.Unmarshal([]byte(*args_matrix), &entries)
+	if err != nil {
+		err = fmt.Errorf("parsing --args-matrix: %s", err)
+		return
+	}
+	for _, entry := range entries {
+		var s string
+		var list []string
+		if json.Unmarshal(entry, &s) == nil {
+			variants = append(variants, strings.Fields(s))
+		} else if json.Unmarshal(entry, &list) == nil {
+			variants = append(variants, list)
+		} else {
+			err = fmt.Errorf("parsing --args-matrix: %s is neither a string nor a list of strings", entry)
+			return
+		}
+	}
+	if len(variants) == 0 {
+		err = fmt.Errorf("--args-matrix has no entries")
+	}
+	return
+}
+
+// runMatrix is like run, but every launch runs the program once for every
+// variant, after args. Once all variants are done, their exit codes are
+// summarized.
+func runMatrix(binName, binPath string, args []string, variants [][]string) (runch chan bool) {
+	runch = make(chan bool)
+	go func() {
+		var cancel, done chan bool
+		for relaunch := range runch {
+			if cancel != nil {
+				close(cancel)
+				<-done
+				cancel = nil
+			}
+			if !relaunch {
+				continue
+			}
+			cancel, done = make(chan bool), make(chan bool)
+			go runVariants(binName, binPath, args, variants, cancel, done)
+		}
+	}()
+	return
+}
+
+func runVariants(binName, binPath string, args []string, variants [][]string, cancel, done chan bool) {
+	defer close(done)
+
+	waitForServices()
+	waitForDevices()
+	waitStartDelay()
+	stdin := nextStdinFixture()
+	procs := make([]*child, len(variants))
+	start := func(i int) {
+		label := strings.Join(variants[i], " ")
+		vargs := append(append([]string{}, args...), variants[i]...)
+		var stdout io.Writer = newPrefixWriter(os.Stdout, "["+label+"] ")
+		var afterExit func()
+		if *golden_dir != "" {
+			golden := newGoldenOutput(binName, variants[i])
+			stdout, afterExit = io.MultiWriter(stdout, golden), golden.compare
+		}
+		cmd, err := childCommand(binPath, vargs, stdin, stdout, newPrefixWriter(os.Stderr, "["+label+"] "))
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		log.Print(append([]string{binName}, vargs...))
+		procs[i], err = startChild(binName+" "+label, cmd, afterExit)
+		if err != nil {
+			log.Printf("error on starting process: '%s'\n", err)
+		}
+	}
+	// wait returns false when the matrix run was canceled.
+	wait := func(i int) bool {
+		if procs[i] == nil {
+			return true
+		}
+		select {
+		case <-procs[i].exited:
+			return true
+		case <-cancel:
+			for _, proc := range procs {
+				if proc != nil {
+					proc.stop()
+				}
+			}
+			return false
+		}
+	}
+
+	for i := range variants {
+		start(i)
+		if !*args_matrix_parallel && !wait(i) {
+			return
+		}
+	}
+	for i := range variants {
+		if !wait(i) {
+			return
+		}
+	}
+
+	failed := 0
+	for i, proc := range procs {
+		status := "ok"
+		switch {
+		case proc == nil:
+			status = "did not start"
+		case proc.err != nil:
+			status = proc.err.Error()
+		}
+		if status != "ok" {
+			failed++
+		}
+		log.Printf("  %s: %s", strings.Join(variants[i], " "), status)
+	}
+	log.Printf("%d of %d variants failed", failed, len(variants))
+}
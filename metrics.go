@@ -0,0 +1,80 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// the upper bounds of the build duration buckets, in seconds.
+var buildBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60, 120}
+
+// a histogram counts observations into buildBuckets, like prometheus'.
+type histogram struct {
+	counts []int // per bucket, not cumulative
+	count  int
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]int, len(buildBuckets))
+	}
+	s := d.Seconds()
+	for i, le := range buildBuckets {
+		if s <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+// serveMetrics writes the counters of all programs in prometheus' text
+// format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	loopStatus.Lock()
+	defer loopStatus.Unlock()
+
+	names := []string{}
+	for name := range loopStatus.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	counter := func(metric, help string, value func(t *targetStatus) int) {
+		fmt.Fprintf(w, "# HELP rerun_%s %s\n# TYPE rerun_%s counter\n", metric, help, metric)
+		for _, name := range names {
+			fmt.Fprintf(w, "rerun_%s{target=%q} %d\n", metric, name, value(loopStatus.targets[name]))
+		}
+	}
+	counter("builds_total", "Builds started.", func(t *targetStatus) int { return t.Builds })
+	counter("build_failures_total", "Builds that failed.", func(t *targetStatus) int { return t.buildFailures })
+	counter("child_restarts_total", "Times the program was started again.", func(t *targetStatus) int { return t.restarts })
+
+	fmt.Fprintf(w, "# HELP rerun_build_duration_seconds Duration of the builds.\n# TYPE rerun_build_duration_seconds histogram\n")
+	for _, name := range names {
+		writeHistogram(w, "rerun_build_duration_seconds", name, &loopStatus.targets[name].buildDurations)
+	}
+}
+
+func writeHistogram(w io.Writer, metric, target string, h *histogram) {
+	cumulative := 0
+	for i, le := range buildBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{target=%q,le=\"%g\"} %d\n", metric, target, le, cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{target=%q,le=\"+Inf\"} %d\n", metric, target, h.count)
+	fmt.Fprintf(w, "%s_sum{target=%q} %g\n", metric, target, h.sum)
+	fmt.Fprintf(w, "%s_count{target=%q} %d\n", metric, target, h.count)
+}
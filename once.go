@@ -0,0 +1,99 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var run_once = flag.Bool("once", false, "Build, test and run the program once without watching, and exit with its exit code")
+
+// once builds, tests and runs every program a single time, with every
+// variant of --args-matrix one after the other. It returns the exit code
+// for rerun: 1 when building or testing fails, else the exit code of the
+// integration suite if there is one, or the first non-zero exit code of
+// the programs.
+func once(buildpaths []string, args []string) (code int) {
+	variants, err := argsMatrix()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if variants == nil {
+		variants = [][]string{nil}
+	}
+
+	var procs []*child
+	for _, buildpath := range buildpaths {
+		pkg, err := checkMain(buildpath)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if !buildTestRun(buildpath, nil) {
+			return 1
+		}
+		if *never_run {
+			continue
+		}
+
+		binName, binPath := binaryPath(buildpath, pkg)
+		waitForServices()
+		waitForDevices()
+		waitStartDelay()
+		for _, variant := range variants {
+			vargs := append(append([]string{}, args...), variant...)
+			cmd, err := childCommand(binPath, vargs, nextStdinFixture(), os.Stdout, os.Stderr)
+			if err != nil {
+				log.Print(err)
+				return 1
+			}
+			log.Print(append([]string{binName}, vargs...))
+			name := strings.TrimSpace(binName + " " + strings.Join(variant, " "))
+			proc, err := startChild(name, cmd, nil)
+			if err != nil {
+				log.Printf("error on starting process: '%s'\n", err)
+				return 1
+			}
+			// the variants of a program run one at a time, the programs
+			// side by side.
+			if len(variants) > 1 {
+				<-proc.exited
+			}
+			procs = append(procs, proc)
+		}
+	}
+
+	// with an integration suite, the programs are stopped once it ran.
+	if *integration_cmd != "" && len(procs) > 0 {
+		suite := startIntegration(procs[0])
+		<-suite.done
+		stopAll()
+		return suite.code
+	}
+
+	for _, proc := range procs {
+		<-proc.exited
+		if code == 0 {
+			code = exitCode(proc.err)
+		}
+	}
+	return
+}
+
+// exitCode returns the exit code of a process that exited with err.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
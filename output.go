@@ -0,0 +1,165 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log"
+	"regexp"
+	"sync"
+)
+
+var (
+	output_filter  = flag.String("filter", "", "Only show the lines of the program's output matching this regular expression, e.g. 'ERROR|WARN'")
+	output_exclude = flag.String("exclude", "", "Hide the lines of the program's output matching this regular expression, e.g. 'healthz'")
+	restart_on     = flag.String("restart-on-output", "", "Restart the program when it prints a line matching this regular expression")
+)
+
+// a prefixWriter writes every line written to it to w, starting with
+// prefix. Several prefixWriters can share w, lines are never interleaved.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	mu      *sync.Mutex
+	partial []byte
+}
+
+// outputMu serializes the lines of all prefixWriters.
+var outputMu sync.Mutex
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix, mu: &outputMu}
+}
+
+func (p *prefixWriter) Write(b []byte) (n int, err error) {
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		p.mu.Lock()
+		_, err = io.WriteString(p.w, p.prefix+string(p.partial[:i+1]))
+		p.mu.Unlock()
+		p.partial = p.partial[i+1:]
+		if err != nil {
+			return
+		}
+	}
+	n = len(b)
+	return
+}
+
+// a filterWriter writes the lines written to it to w if they match
+// include, when set, and don't match exclude, when set. Once the program
+// panics, all lines are written, so the stack trace is never hidden.
+type filterWriter struct {
+	w                io.Writer
+	include, exclude *regexp.Regexp
+	partial          []byte
+	panicked         bool
+}
+
+// withFilter returns w showing only the lines selected with --filter and
+// --exclude.
+func withFilter(w io.Writer) io.Writer {
+	if *output_filter == "" && *output_exclude == "" {
+		return w
+	}
+	f := &filterWriter{w: w}
+	var err error
+	if *output_filter != "" {
+		f.include, err = regexp.Compile(*output_filter)
+		if err != nil {
+			log.Printf("error on compiling --filter: '%s'\n", err)
+			return w
+		}
+	}
+	if *output_exclude != "" {
+		f.exclude, err = regexp.Compile(*output_exclude)
+		if err != nil {
+			log.Printf("error on compiling --exclude: '%s'\n", err)
+			return w
+		}
+	}
+	return f
+}
+
+func (f *filterWriter) Write(b []byte) (n int, err error) {
+	f.partial = append(f.partial, b...)
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := f.partial[:i+1]
+		f.partial = f.partial[i+1:]
+		if bytes.HasPrefix(line, []byte("panic: ")) || bytes.HasPrefix(line, []byte("fatal error: ")) {
+			f.panicked = true
+		}
+		if !f.panicked && f.include != nil && !f.include.Match(line) {
+			continue
+		}
+		if !f.panicked && f.exclude != nil && f.exclude.Match(line) {
+			continue
+		}
+		_, err = f.w.Write(line)
+		if err != nil {
+			return
+		}
+	}
+	n = len(b)
+	return
+}
+
+// a lineMatcher calls matched once, for the first line written to it
+// that matches re.
+type lineMatcher struct {
+	re      *regexp.Regexp
+	matched func(line string)
+	once    sync.Once
+	mu      sync.Mutex
+	partial []byte
+}
+
+// watchOutput returns stdout and stderr calling restart when the program
+// prints a line matching --restart-on-output.
+func watchOutput(stdout, stderr io.Writer, restart func()) (io.Writer, io.Writer) {
+	if *restart_on == "" {
+		return stdout, stderr
+	}
+	re, err := regexp.Compile(*restart_on)
+	if err != nil {
+		log.Printf("error on compiling --restart-on-output: '%s'\n", err)
+		return stdout, stderr
+	}
+	m := &lineMatcher{re: re, matched: func(line string) {
+		log.Printf("restarting, the program printed %q", line)
+		restart()
+	}}
+	return io.MultiWriter(stdout, m), io.MultiWriter(stderr, m)
+}
+
+func (m *lineMatcher) Write(b []byte) (n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.partial = append(m.partial, b...)
+	for {
+		i := bytes.IndexByte(m.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := m.partial[:i]
+		m.partial = m.partial[i+1:]
+		if m.re.Match(line) {
+			m.once.Do(func() {
+				m.matched(string(bytes.TrimRight(line, "\r")))
+			})
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// the most recent panic of the program is kept here, so it isn't lost in
+// the scrollback.
+var lastPanicPath = filepath.Join(".rerun", "last-panic.txt")
+
+// a stack frame location in a goroutine trace, like
+//
+//	/home/me/src/foo/main.go:12 +0x1d
+var frameRE = regexp.MustCompile(`^\t(.+\.go):(\d+)`)
+
+// a panicScanner passes everything written to it through to w, line by
+// line, looking for a panic. Once the program panics, the trace is
+// highlighted, runtime frames are collapsed and the whole trace is saved to
+// lastPanicPath. found is called with the location of the topmost stack
+// frame outside of GOROOT.
+type panicScanner struct {
+	w     io.Writer
+	found func(file string, line int)
+	color bool
+
+	partial []byte
+	inPanic bool
+	located bool
+	record  *os.File
+
+	// the function line of the frame whose location is read next.
+	function string
+	// the number of runtime frames not printed since the last frame that was.
+	collapsed int
+}
+
+func newPanicScanner(w io.Writer, found func(file string, line int)) *panicScanner {
+	return &panicScanner{w: w, found: found, color: isTerminalWriter(w)}
+}
+
+func (p *panicScanner) Write(b []byte) (n int, err error) {
+	p.partial = append(p.partial, b...)
+	for {
+		// \r ends a line as well, so progress bars are not held back.
+		i := strings.IndexAny(string(p.partial), "\n\r")
+		if i < 0 {
+			break
+		}
+		err = p.scanLine(string(p.partial[:i]), p.partial[i])
+		p.partial = p.partial[i+1:]
+		if err != nil {
+			return
+		}
+	}
+	n = len(b)
+	return
+}
+
+func (p *panicScanner) scanLine(line string, end byte) (err error) {
+	if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+		if !p.inPanic {
+			p.startPanic()
+		}
+		p.recordLine(line)
+		return p.print(line, end, "1;31")
+	}
+	if !p.inPanic {
+		return p.print(line, end, "")
+	}
+	p.recordLine(line)
+
+	if p.function != "" {
+		function := p.function
+		p.function = ""
+		m := frameRE.FindStringSubmatch(line)
+		if m == nil {
+			p.print(function, '\n', "")
+			return p.print(line, end, "")
+		}
+		if isRuntimeFrame(function, m[1]) {
+			p.collapsed++
+			return
+		}
+		p.flushCollapsed()
+		p.print(function, '\n', "1")
+		if !p.located && !strings.HasPrefix(m[1], runtime.GOROOT()) {
+			p.located = true
+			lineno, _ := strconv.Atoi(m[2])
+			p.found(m[1], lineno)
+		}
+		return p.print(line, end, "")
+	}
+
+	switch {
+	case strings.HasPrefix(line, "goroutine "):
+		p.flushCollapsed()
+		return p.print(line, end, "33")
+	case strings.HasPrefix(line, "created by ") || isFunctionLine(line):
+		p.function = line
+		return
+	}
+	p.flushCollapsed()
+	return p.print(line, end, "")
+}
+
+func (p *panicScanner) startPanic() {
+	p.inPanic = true
+	if p.record != nil {
+		p.record.Close()
+	}
+	os.MkdirAll(filepath.Dir(lastPanicPath), 0755)
+	p.record, _ = os.Create(lastPanicPath)
+}
+
+func (p *panicScanner) recordLine(line string) {
+	if p.record != nil {
+		fmt.Fprintln(p.record, line)
+	}
+}
+
+func (p *panicScanner) flushCollapsed() {
+	if p.collapsed == 0 {
+		return
+	}
+	p.print(fmt.Sprintf("\t... %d runtime frames ...", p.collapsed), '\n', "2")
+	p.collapsed = 0
+}
+
+// print writes line to w, in the given SGR color when w is a terminal.
+func (p *panicScanner) print(line string, end byte, color string) (err error) {
+	if p.color && color != "" {
+		line = "\x1b[" + color + "m" + line + "\x1b[0m"
+	}
+	_, err = io.WriteString(p.w, line+string(end))
+	return
+}
+
+// isFunctionLine reports whether line is the function part of a frame,
+// like "main.main()" or "main.(*T).f(0x1, ...)".
+func isFunctionLine(line string) bool {
+	return line != "" && !strings.HasPrefix(line, "\t") && strings.HasSuffix(line, ")") && strings.Contains(line, "(")
+}
+
+func isRuntimeFrame(function, file string) bool {
+	return strings.HasPrefix(function, "runtime.") || strings.HasPrefix(function, "panic(") ||
+		strings.HasPrefix(file, filepath.Join(runtime.GOROOT(), "src", "runtime")+string(filepath.Separator))
+}
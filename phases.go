@@ -0,0 +1,115 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	custom_phases stringList
+	phase_when    stringList
+	explain       = flag.Bool("explain", false, "Log why phases run or are skipped")
+)
+
+func init() {
+	flag.Var(&custom_phases, "phase", "Shell command run after building and testing, before restarting (repeatable): NAME=<command>")
+	flag.Var(&phase_when, "when", "Run a phase only when a changed file matches a glob (repeatable): <phase>=<glob>, the phases are test, bench, fuzz, build, integration and the stages")
+}
+
+// shouldRun reports whether phase runs in this cycle: as should_run of the
+// --script decides, otherwise when it has no --when globs or globs of its
+// stage, in the first cycle and when rebuilding was triggered, or when a
+// changed file matches one of its globs.
+func shouldRun(phase string) bool {
+	if yes, decided := scriptShouldRun(phase); decided {
+		if yes {
+			explainf("%s: running, should_run of %s says so", phase, script.path)
+		} else {
+			explainf("%s: skipped, should_run of %s says so", phase, script.path)
+		}
+		return yes
+	}
+	globs := stageGlobs(phase)
+	for _, w := range phase_when {
+		if eq := strings.Index(w, "="); eq > 0 && w[:eq] == phase {
+			globs = append(globs, w[eq+1:])
+		}
+	}
+	if len(globs) == 0 {
+		return true
+	}
+	if cycleChanges == nil {
+		explainf("%s: running, not triggered by changes", phase)
+		return true
+	}
+	for _, name := range cycleChanges {
+		rel := relativeName(name)
+		for _, glob := range globs {
+			if matchGlob(glob, rel) {
+				explainf("%s: running, %s matches %s", phase, rel, glob)
+				return true
+			}
+		}
+	}
+	explainf("%s: skipped, no change matches %s", phase, strings.Join(globs, " or "))
+	return false
+}
+
+func explainf(format string, a ...interface{}) {
+	if *explain {
+		log.Printf(format, a...)
+	}
+}
+
+// relativeName returns name relative to the current directory, with
+// slashes, as globs are written.
+func relativeName(name string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, name); err == nil {
+			name = rel
+		}
+	}
+	return filepath.ToSlash(name)
+}
+
+// matchGlob matches name against a glob where ** matches any number of
+// directories.
+func matchGlob(glob, name string) bool {
+	return matchParts(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// the targets whose integration suite is skipped in this cycle, by name.
+var skipIntegration = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: map[string]bool{}}
@@ -0,0 +1,62 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+// An Op is the kind of a change to a file.
+type Op int
+
+const (
+	Create Op = iota + 1
+	Modify
+	Delete
+	Rename
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Modify:
+		return "modify"
+	case Delete:
+		return "delete"
+	case Rename:
+		return "rename"
+	}
+	return "change"
+}
+
+// A Change is a change to a file, as reported by a Watcher.
+type Change struct {
+	Name string
+	Op   Op
+}
+
+// Merge returns the changes with one change per file, in the order the
+// files first changed. A file created and then modified counts as
+// created, otherwise its last change counts.
+func Merge(changes []Change) (merged []Change) {
+	seen := map[string]int{}
+	for _, c := range changes {
+		i, ok := seen[c.Name]
+		switch {
+		case !ok:
+			seen[c.Name] = len(merged)
+			merged = append(merged, c)
+		case merged[i].Op == Create && c.Op == Modify:
+		default:
+			merged[i].Op = c.Op
+		}
+	}
+	return
+}
+
+// Names returns the names of the changed files.
+func Names(changes []Change) (names []string) {
+	for _, c := range changes {
+		names = append(names, c.Name)
+	}
+	return
+}
@@ -0,0 +1,64 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// A Step is a phase of a Pipeline, like building or testing.
+type Step struct {
+	Name string
+	Run  func() error
+}
+
+// A Pipeline runs its steps in order, stopping at the first failing one.
+type Pipeline struct {
+	Steps []Step
+	// OnStep, when set, is called after every step with how long it took
+	// and its error.
+	OnStep func(name string, d time.Duration, err error)
+}
+
+// Run runs the steps and returns the error of the first failing one.
+func (p *Pipeline) Run() (err error) {
+	for _, step := range p.Steps {
+		start := time.Now()
+		err = step.Run()
+		if p.OnStep != nil {
+			p.OnStep(step.Name, time.Since(start), err)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GoBuild returns a step building the package pkg into the binary out.
+func GoBuild(pkg, out string) Step {
+	return Step{Name: "build", Run: func() error {
+		return goCommand("build", "-o", out, pkg)
+	}}
+}
+
+// GoTest returns a step running the tests of the package pkg.
+func GoTest(pkg string) Step {
+	return Step{Name: "test", Run: func() error {
+		return goCommand("test", pkg)
+	}}
+}
+
+// goCommand runs the go tool, its output is part of the error.
+func goCommand(args ...string) error {
+	out, err := exec.Command("go", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("go %s: %s\n%s", args[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
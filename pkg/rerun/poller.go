@@ -0,0 +1,157 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The interval used when rerun falls back to polling by itself.
+const DefaultPollInterval = time.Second
+
+// A Poller is a Watcher for file systems without change
+// notifications, like network mounts. It compares the modification times
+// and sizes of all files in the watched directories at every interval.
+type Poller struct {
+	interval time.Duration
+	events   chan Change
+	stop     chan bool
+
+	mu   sync.Mutex
+	dirs []string
+}
+
+// the state of a file that is compared between scans.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// a scan is the state of all files in the watched directories. The
+// directories themselves are included with a zero fileState.
+type scan map[string]fileState
+
+func (s scan) hasDir(dir string) bool {
+	_, ok := s[dir]
+	return ok
+}
+
+// NewPoller returns a Poller scanning dirs at every interval.
+func NewPoller(dirs []string, interval time.Duration) (p *Poller) {
+	p = &Poller{
+		dirs:     dirs,
+		interval: interval,
+		events:   make(chan Change),
+		stop:     make(chan bool),
+	}
+	go p.poll()
+	return
+}
+
+func (p *Poller) poll() {
+	defer close(p.events)
+
+	last := p.scan()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := p.scan()
+		for name, state := range current {
+			prev, ok := last[name]
+			// the files of a directory that was just added are not new.
+			if !ok && !last.hasDir(filepath.Dir(name)) {
+				continue
+			}
+			if !ok || prev != state {
+				op := Modify
+				if !ok {
+					op = Create
+				}
+				if !p.send(Change{name, op}) {
+					return
+				}
+			}
+		}
+		// the files of a deleted directory are gone with it, and so is
+		// the directory itself.
+		for name := range last {
+			if _, ok := current[name]; !ok && (p.watches(filepath.Dir(name)) || p.watches(name)) {
+				if !p.send(Change{name, Delete}) {
+					return
+				}
+			}
+		}
+		last = current
+	}
+}
+
+// send reports a changed file, unless the poller is closed first.
+func (p *Poller) send(c Change) bool {
+	select {
+	case p.events <- c:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// watches reports whether dir is one of the watched directories.
+func (p *Poller) watches(dir string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, d := range p.dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Poller) scan() (files scan) {
+	p.mu.Lock()
+	dirs := p.dirs
+	p.mu.Unlock()
+
+	files = scan{}
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		files[dir] = fileState{}
+		for _, fi := range infos {
+			if fi.IsDir() {
+				continue
+			}
+			files[filepath.Join(dir, fi.Name())] = fileState{fi.ModTime(), fi.Size()}
+		}
+	}
+	return
+}
+
+func (p *Poller) Events() <-chan Change {
+	return p.events
+}
+
+func (p *Poller) SetDirs(dirs []string) error {
+	p.mu.Lock()
+	p.dirs = dirs
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Poller) Close() error {
+	close(p.stop)
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rerun rebuilds and restarts a Go program whenever its sources
+// change. It is the loop of the rerun command, for tools embedding it:
+//
+//	err := rerun.Run(rerun.Options{
+//		Package: "github.com/me/server",
+//		Args:    []string{"-addr=:8080"},
+//		Test:    true,
+//	}, stop)
+//
+// Run is put together from a Watcher, a Pipeline and a Supervisor, which
+// can be used on their own.
+package rerun
+
+import (
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Options configure Run.
+type Options struct {
+	// the import path of the program.
+	Package string
+	// the arguments of the program.
+	Args []string
+	// run the tests before restarting the program.
+	Test bool
+	// where the program is built, a temporary file by default.
+	Binary string
+	// watches the directories of the program and its dependencies by
+	// default.
+	Watcher Watcher
+	// where the output of the program goes, discarded when nil.
+	Stdout, Stderr io.Writer
+
+	// OnChange, when set, is called with the changes before every
+	// rebuild.
+	OnChange func(changed []Change)
+	// OnStep, when set, is called after every step of the pipeline.
+	OnStep func(name string, d time.Duration, err error)
+	// OnStart, when set, is called with the pid of every started program.
+	OnStart func(pid int)
+	// OnExit, when set, is called with the result of the program.
+	OnExit func(err error)
+}
+
+// Run builds, tests and runs the program, and does so again whenever its
+// sources change, until stop is closed. The program isn't restarted when
+// the build or the tests fail.
+func Run(opts Options, stop <-chan bool) (err error) {
+	binary := opts.Binary
+	if binary == "" {
+		dir, err := ioutil.TempDir("", "rerun")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		binary = filepath.Join(dir, filepath.Base(opts.Package))
+	}
+
+	watcher := opts.Watcher
+	if watcher == nil {
+		watcher, err = NewFSWatcher(PackageDirs(opts.Package, opts.Test))
+		// the watcher works without the directories it cannot watch.
+		if isPartial(err) {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	defer watcher.Close()
+
+	pipeline := &Pipeline{OnStep: opts.OnStep}
+	if opts.Test {
+		pipeline.Steps = append(pipeline.Steps, GoTest(opts.Package))
+	}
+	pipeline.Steps = append(pipeline.Steps, GoBuild(opts.Package, binary))
+	supervisor := &Supervisor{
+		Path:    binary,
+		Args:    opts.Args,
+		Stdout:  opts.Stdout,
+		Stderr:  opts.Stderr,
+		OnStart: opts.OnStart,
+		OnExit:  opts.OnExit,
+	}
+	defer supervisor.Stop()
+
+	// stop is turned into a trigger of NextChange.
+	triggers := make(chan string)
+	go func() {
+		<-stop
+		close(triggers)
+	}()
+	isSource := func(name string) bool {
+		return filepath.Ext(name) == ".go"
+	}
+	for {
+		if pipeline.Run() == nil {
+			err = supervisor.Start()
+			if err != nil {
+				return
+			}
+		}
+		changed, _, triggered := NextChange(watcher, isSource, triggers)
+		if triggered {
+			return
+		}
+		if opts.OnChange != nil {
+			opts.OnChange(changed)
+		}
+		watcher.SetDirs(PackageDirs(opts.Package, opts.Test))
+	}
+}
+
+// PackageDirs returns the directories of the package pkg and of the
+// packages it imports, leaving out the standard library. With test, the
+// packages imported by the tests of pkg are included.
+func PackageDirs(pkg string, test bool) (dirs []string) {
+	seen := map[string]bool{}
+	var visit func(path, srcDir string)
+	visit = func(path, srcDir string) {
+		if path == "C" || seen[path] {
+			return
+		}
+		seen[path] = true
+		p, err := build.Import(path, srcDir, 0)
+		if p.Dir == "" || p.Goroot {
+			return
+		}
+		dirs = append(dirs, p.Dir)
+		if err != nil {
+			return
+		}
+		imports := p.Imports
+		// only the tests of pkg itself are run.
+		if test && path == pkg {
+			imports = append(append(append([]string{}, imports...), p.TestImports...), p.XTestImports...)
+		}
+		for _, imp := range imports {
+			if !strings.HasPrefix(imp, ".") {
+				visit(imp, p.Dir)
+			}
+		}
+	}
+	visit(pkg, "")
+	return
+}
@@ -0,0 +1,140 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// A Supervisor runs a program, restarting it on demand.
+type Supervisor struct {
+	Path   string
+	Args   []string
+	Env    []string
+	Stdout io.Writer
+	Stderr io.Writer
+	// how long the program has to exit after being interrupted before it
+	// is killed, 5 seconds when zero, never when negative.
+	StopTimeout time.Duration
+
+	// Command, when set, makes the command to start instead of Path,
+	// Args, Env, Stdout and Stderr, for programs that need more, like
+	// another directory or a terminal.
+	Command func() (*exec.Cmd, error)
+	// Interrupt, when set, asks the program to exit instead of sending
+	// it os.Interrupt, and Kill kills it, e.g. along with the processes
+	// it started. The program is killed when interrupting it fails.
+	Interrupt func(cmd *exec.Cmd) error
+	Kill      func(cmd *exec.Cmd) error
+
+	// OnStart, when set, is called with the pid of every started program.
+	OnStart func(pid int)
+	// OnExit, when set, is called with the result of the program when it
+	// exits, also when it was stopped.
+	OnExit func(err error)
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	exited chan bool
+}
+
+// Start starts the program, stopping the running one first.
+func (s *Supervisor) Start() (err error) {
+	s.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd, err := s.command()
+	if err != nil {
+		return
+	}
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+	exited := make(chan bool)
+	s.cmd, s.exited = cmd, exited
+	if s.OnStart != nil {
+		s.OnStart(cmd.Process.Pid)
+	}
+	go func() {
+		err := cmd.Wait()
+		if s.OnExit != nil {
+			s.OnExit(err)
+		}
+		close(exited)
+	}()
+	return
+}
+
+func (s *Supervisor) command() (cmd *exec.Cmd, err error) {
+	if s.Command != nil {
+		return s.Command()
+	}
+	cmd = exec.Command(s.Path, s.Args...)
+	cmd.Env = s.Env
+	cmd.Stdout = s.Stdout
+	cmd.Stderr = s.Stderr
+	return
+}
+
+// Restart stops the program and starts it again.
+func (s *Supervisor) Restart() error {
+	return s.Start()
+}
+
+// Stop interrupts the program and waits for it to exit, killing it when it
+// doesn't within StopTimeout.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.cmd, s.exited = nil, nil
+	s.mu.Unlock()
+	if cmd == nil {
+		return
+	}
+	select {
+	case <-exited:
+		return
+	default:
+	}
+
+	timeout := s.StopTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	// interrupting isn't possible on windows.
+	if s.interrupt(cmd) != nil {
+		s.kill(cmd)
+	}
+	if timeout < 0 {
+		<-exited
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		s.kill(cmd)
+		<-exited
+	}
+}
+
+func (s *Supervisor) interrupt(cmd *exec.Cmd) error {
+	if s.Interrupt != nil {
+		return s.Interrupt(cmd)
+	}
+	return cmd.Process.Signal(os.Interrupt)
+}
+
+func (s *Supervisor) kill(cmd *exec.Cmd) error {
+	if s.Kill != nil {
+		return s.Kill(cmd)
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,172 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A TreeWatcher is a Watcher for large trees of directories, using the
+// recursive notifications of FSEvents on macOS and ReadDirectoryChangesW
+// on Windows. It needs one watch per tree instead of one per directory,
+// and only reports the changes in the watched directories themselves.
+type TreeWatcher struct {
+	events chan Change
+	done   chan bool
+	// the senders of the trees, events is closed once they are gone.
+	senders sync.WaitGroup
+
+	mu sync.Mutex
+	// the watched directories by the path the system reports them with,
+	// without symbolic links.
+	dirs map[string]string
+	// the stop functions of the watched trees, by their root.
+	trees map[string]func()
+
+	// watch watches the tree of root, calling send for every change
+	// until stop is called, and done once it won't call send anymore.
+	watch func(root string, send func(name string, op Op) bool, done func()) (stop func(), err error)
+	// root returns the root of the tree to watch for dir.
+	root func(dir string, dirs map[string]string) (root string, err error)
+}
+
+// NewTreeWatcher returns a TreeWatcher watching dirs. It fails on systems
+// without recursive notifications.
+func NewTreeWatcher(dirs []string) (*TreeWatcher, error) {
+	return newTreeWatcher(dirs, watchTree, topmost)
+}
+
+func newTreeWatcher(dirs []string, watch func(root string, send func(name string, op Op) bool, done func()) (func(), error), root func(dir string, dirs map[string]string) (string, error)) (tw *TreeWatcher, err error) {
+	tw = &TreeWatcher{
+		events: make(chan Change),
+		done:   make(chan bool),
+		dirs:   map[string]string{},
+		trees:  map[string]func(){},
+		watch:  watch,
+		root:   root,
+	}
+	err = tw.SetDirs(dirs)
+	if err != nil {
+		tw.Close()
+		tw = nil
+	}
+	return
+}
+
+// send reports a change, if it is in a watched directory. It returns
+// false once the watcher is closed.
+func (tw *TreeWatcher) send(name string, op Op) bool {
+	tw.mu.Lock()
+	dir, ok := tw.dirs[name]
+	if ok {
+		// a watched directory itself was deleted or renamed.
+		name = dir
+	} else if dir, ok = tw.dirs[filepath.Dir(name)]; ok {
+		name = filepath.Join(dir, filepath.Base(name))
+	}
+	tw.mu.Unlock()
+	if !ok {
+		return true
+	}
+	select {
+	case tw.events <- Change{name, op}:
+		return true
+	case <-tw.done:
+		return false
+	}
+}
+
+func (tw *TreeWatcher) Events() <-chan Change {
+	return tw.events
+}
+
+// SetDirs watches the trees of the topmost of dirs, keeping the trees
+// that are still needed.
+func (tw *TreeWatcher) SetDirs(dirs []string) error {
+	real := map[string]string{}
+	for _, dir := range dirs {
+		path, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			// deleted meanwhile.
+			path = dir
+		}
+		path, _ = filepath.Abs(path)
+		real[path] = dir
+	}
+	roots := map[string]bool{}
+	for path := range real {
+		if _, err := os.Stat(path); err != nil {
+			// it only has a tree once it comes back.
+			continue
+		}
+		root, err := tw.root(path, real)
+		if err != nil {
+			return err
+		}
+		roots[root] = true
+	}
+
+	tw.mu.Lock()
+	tw.dirs = real
+	var stop []func()
+	for root, stopTree := range tw.trees {
+		if !roots[root] {
+			stop = append(stop, stopTree)
+			delete(tw.trees, root)
+		}
+	}
+	var start []string
+	for root := range roots {
+		if _, ok := tw.trees[root]; !ok {
+			start = append(start, root)
+		}
+	}
+	tw.mu.Unlock()
+
+	for _, stopTree := range stop {
+		stopTree()
+	}
+	for _, root := range start {
+		tw.senders.Add(1)
+		stopTree, err := tw.watch(root, tw.send, tw.senders.Done)
+		if err != nil {
+			tw.senders.Done()
+			return err
+		}
+		tw.mu.Lock()
+		tw.trees[root] = stopTree
+		tw.mu.Unlock()
+	}
+	return nil
+}
+
+// topmost returns the outermost directory of dirs containing path.
+func topmost(path string, dirs map[string]string) (string, error) {
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, ok := dirs[dir]; ok {
+			path = dir
+		}
+	}
+	return path, nil
+}
+
+func (tw *TreeWatcher) Close() error {
+	tw.mu.Lock()
+	trees := tw.trees
+	tw.trees = map[string]func(){}
+	tw.mu.Unlock()
+
+	close(tw.done)
+	for _, stopTree := range trees {
+		stopTree()
+	}
+	go func() {
+		tw.senders.Wait()
+		close(tw.events)
+	}()
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package rerun
+
+import (
+	"github.com/fsnotify/fsevents"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchTree watches the tree of root with FSEvents, calling send for
+// every change until stop is called. done is called once send won't be
+// called anymore.
+func watchTree(root string, send func(name string, op Op) bool, done func()) (stop func(), err error) {
+	es := &fsevents.EventStream{
+		Paths:   []string{root},
+		Latency: 10 * time.Millisecond,
+		Flags:   fsevents.FileEvents | fsevents.NoDefer,
+	}
+	err = es.Start()
+	if err != nil {
+		return
+	}
+
+	quit := make(chan bool)
+	go func() {
+		defer done()
+		defer func() {
+			// FSEvents waits for the events on their way to be taken.
+			stopped := make(chan bool)
+			go func() {
+				es.Stop()
+				close(stopped)
+			}()
+			for {
+				select {
+				case <-es.Events:
+				case <-stopped:
+					return
+				}
+			}
+		}()
+		for {
+			select {
+			case <-quit:
+				return
+			case events := <-es.Events:
+				for _, e := range events {
+					if !send(filepath.Join("/", e.Path), fsOp(e)) {
+						return
+					}
+				}
+			}
+		}
+	}()
+	stop = func() {
+		close(quit)
+	}
+	return
+}
+
+// fsOp tells the change of an event, which may sum up several changes to
+// the same path.
+func fsOp(e fsevents.Event) Op {
+	_, err := os.Lstat(filepath.Join("/", e.Path))
+	gone := os.IsNotExist(err)
+	switch {
+	case e.Flags&fsevents.ItemRemoved != 0 && gone:
+		return Delete
+	case e.Flags&fsevents.ItemRenamed != 0 && gone:
+		// renames are reported for both names, this is the old one.
+		return Rename
+	case e.Flags&(fsevents.ItemCreated|fsevents.ItemRenamed) != 0:
+		return Create
+	}
+	return Modify
+}
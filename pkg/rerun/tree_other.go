@@ -0,0 +1,19 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !(darwin && cgo)
+// +build !windows
+// +build !darwin !cgo
+
+package rerun
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func watchTree(root string, send func(name string, op Op) bool, done func()) (stop func(), err error) {
+	err = fmt.Errorf("watching whole trees of directories is not supported on %s", runtime.GOOS)
+	return
+}
@@ -0,0 +1,100 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchTree watches the tree of root with ReadDirectoryChangesW, calling
+// send for every change until stop is called. done is called once send
+// won't be called anymore.
+func watchTree(root string, send func(name string, op Op) bool, done func()) (stop func(), err error) {
+	path, err := syscall.UTF16PtrFromString(root)
+	if err != nil {
+		return
+	}
+	h, err := syscall.CreateFile(path, syscall.FILE_LIST_DIRECTORY,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return
+	}
+	port, err := syscall.CreateIoCompletionPort(h, 0, 0, 0)
+	if err != nil {
+		syscall.CloseHandle(h)
+		return
+	}
+
+	const mask = syscall.FILE_NOTIFY_CHANGE_FILE_NAME | syscall.FILE_NOTIFY_CHANGE_DIR_NAME |
+		syscall.FILE_NOTIFY_CHANGE_SIZE | syscall.FILE_NOTIFY_CHANGE_LAST_WRITE | syscall.FILE_NOTIFY_CHANGE_CREATION
+	buf := make([]byte, 64*1024)
+	var ov syscall.Overlapped
+	read := func() error {
+		return syscall.ReadDirectoryChanges(h, &buf[0], uint32(len(buf)), true, mask, nil, &ov, 0)
+	}
+	err = read()
+	if err != nil {
+		syscall.CloseHandle(port)
+		syscall.CloseHandle(h)
+		return
+	}
+
+	go func() {
+		defer done()
+		defer syscall.CloseHandle(port)
+		defer syscall.CloseHandle(h)
+		for {
+			var n, key uint32
+			var pov *syscall.Overlapped
+			err := syscall.GetQueuedCompletionStatus(port, &n, &key, &pov, syscall.INFINITE)
+			if pov == nil || err == syscall.ERROR_OPERATION_ABORTED {
+				// stopped.
+				return
+			}
+			if err == nil && !sendChanges(root, buf[:n], send) {
+				return
+			}
+			// with err set, or n == 0, the buffer overflowed and changes
+			// are lost.
+			if read() != nil {
+				return
+			}
+		}
+	}()
+	stop = func() {
+		syscall.CancelIoEx(h, &ov)
+		syscall.PostQueuedCompletionStatus(port, 0, 0, nil)
+	}
+	return
+}
+
+// sendChanges sends the changes in buf, a list of FILE_NOTIFY_INFORMATION
+// records. It returns false once send does.
+func sendChanges(root string, buf []byte, send func(name string, op Op) bool) bool {
+	for offset := uint32(0); int(offset) < len(buf); {
+		info := (*syscall.FileNotifyInformation)(unsafe.Pointer(&buf[offset]))
+		name := unsafe.Slice(&info.FileName, info.FileNameLength/2)
+		op := Modify
+		switch info.Action {
+		case syscall.FILE_ACTION_ADDED, syscall.FILE_ACTION_RENAMED_NEW_NAME:
+			op = Create
+		case syscall.FILE_ACTION_REMOVED:
+			op = Delete
+		case syscall.FILE_ACTION_RENAMED_OLD_NAME:
+			op = Rename
+		}
+		if !send(filepath.Join(root, syscall.UTF16ToString(name)), op) {
+			return false
+		}
+		if info.NextEntryOffset == 0 {
+			return true
+		}
+		offset += info.NextEntryOffset
+	}
+	return true
+}
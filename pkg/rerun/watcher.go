@@ -0,0 +1,298 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A Watcher reports the changes to the files in the directories it
+// watches.
+type Watcher interface {
+	// Events is closed once the watcher is closed.
+	Events() <-chan Change
+	// SetDirs changes the set of watched directories.
+	SetDirs(dirs []string) error
+	Close() error
+}
+
+// Editors often write a file in several steps, changes are only reported
+// once the files have settled for this long.
+const SettleTime = 100 * time.Millisecond
+
+// NextChange waits for a source file to change and returns the changes
+// of all source files until things settled down, in the order the files
+// first changed. When a trigger arrives first, it returns its source
+// instead.
+func NextChange(watcher Watcher, isSource func(name string) bool, triggers <-chan string) (changed []Change, source string, triggered bool) {
+	var settled <-chan time.Time
+	for {
+		select {
+		case source = <-triggers:
+			if len(changed) == 0 {
+				triggered = true
+				return
+			}
+			// the rebuild for the changes is on its way anyway.
+		case c := <-watcher.Events():
+			// other files in the directory don't count - we watch the whole thing in case new .go files appear.
+			if !isSource(c.Name) {
+				continue
+			}
+			changed = Merge(append(changed, c))
+			settled = time.After(SettleTime)
+		case <-settled:
+			return
+		}
+	}
+}
+
+// IsWatchLimit reports whether err means that the system is out of
+// inotify instances or watches.
+func IsWatchLimit(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENOSPC)
+}
+
+// A WatchLimitError reports the directories an FSWatcher polls because
+// the system ran out of watches. The watcher keeps working.
+type WatchLimitError struct {
+	Err error
+	// the number of directories to watch.
+	Needed    int
+	Unwatched []string
+}
+
+func (e *WatchLimitError) Error() string {
+	return fmt.Sprintf("cannot watch %d of %d directories: %s", len(e.Unwatched), e.Needed, e.Err)
+}
+
+func (e *WatchLimitError) Unwrap() error {
+	return e.Err
+}
+
+// A DirsError reports the directories an FSWatcher could not watch, e.g.
+// because they are not readable, by directory. The watcher keeps working
+// without them.
+type DirsError map[string]error
+
+func (e DirsError) Error() string {
+	if len(e) == 1 {
+		for dir, err := range e {
+			return fmt.Sprintf("cannot watch %s: %s", dir, err)
+		}
+	}
+	return fmt.Sprintf("cannot watch %d directories", len(e))
+}
+
+// isPartial reports whether err still leaves a working FSWatcher.
+func isPartial(err error) bool {
+	switch err.(type) {
+	case *WatchLimitError, DirsError:
+		return true
+	}
+	return false
+}
+
+// An FSWatcher is a Watcher using the notifications of the OS. The
+// directories it cannot watch once the system runs out of watches are
+// polled.
+type FSWatcher struct {
+	watcher *fsnotify.Watcher
+	events  chan Change
+	errors  chan error
+	done    chan bool
+	// the forwarders of the events, events is closed once they are gone.
+	senders sync.WaitGroup
+
+	mu       sync.Mutex
+	watching map[string]bool
+	poller   *Poller
+}
+
+// NewFSWatcher returns an FSWatcher watching dirs. When the system runs
+// out of watches or some directories cannot be watched, it returns a
+// working FSWatcher along with a WatchLimitError or a DirsError.
+func NewFSWatcher(dirs []string) (fw *FSWatcher, err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+
+	fw = &FSWatcher{
+		watcher:  watcher,
+		events:   make(chan Change),
+		errors:   make(chan error, 16),
+		done:     make(chan bool),
+		watching: map[string]bool{},
+	}
+	err = fw.SetDirs(dirs)
+	if err != nil && !isPartial(err) {
+		watcher.Close()
+		fw = nil
+		return
+	}
+	fw.senders.Add(1)
+	go fw.forward()
+	go func() {
+		fw.senders.Wait()
+		close(fw.events)
+	}()
+	return
+}
+
+func (fw *FSWatcher) forward() {
+	defer fw.senders.Done()
+	// the errors are passed on as long as they are taken, and dropped
+	// otherwise to avoid a deadlock.
+	go func(errors chan error) {
+		defer close(fw.errors)
+		for err := range errors {
+			select {
+			case fw.errors <- err:
+			default:
+			}
+		}
+	}(fw.watcher.Errors)
+
+	for we := range fw.watcher.Events {
+		op := Modify
+		switch {
+		case we.Has(fsnotify.Create):
+			op = Create
+		case we.Has(fsnotify.Remove):
+			op = Delete
+		case we.Has(fsnotify.Rename):
+			op = Rename
+		}
+		if op == Delete || op == Rename {
+			fw.forget(we.Name)
+		}
+		if !fw.send(Change{we.Name, op}) {
+			return
+		}
+	}
+}
+
+func (fw *FSWatcher) forwardPolled(p *Poller) {
+	defer fw.senders.Done()
+	for c := range p.Events() {
+		if !fw.send(c) {
+			return
+		}
+	}
+}
+
+// send passes on a change. It returns false once the watcher is closed,
+// when nobody takes the changes anymore.
+func (fw *FSWatcher) send(c Change) bool {
+	select {
+	case fw.events <- c:
+		return true
+	case <-fw.done:
+		return false
+	}
+}
+
+// forget drops the watch of a watched directory that was deleted or
+// renamed, so that SetDirs watches it again should it reappear. A
+// renamed directory would otherwise still be reported under its old
+// name.
+func (fw *FSWatcher) forget(dir string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.watching[dir] {
+		fw.watcher.Remove(dir)
+		delete(fw.watching, dir)
+	}
+}
+
+// Errors reports the errors of the notifications, e.g. that events were
+// lost. It is closed once the watcher is closed.
+func (fw *FSWatcher) Errors() <-chan error {
+	return fw.errors
+}
+
+func (fw *FSWatcher) Events() <-chan Change {
+	return fw.events
+}
+
+// SetDirs adds watches for new directories and removes the watches of
+// directories no longer needed, leaving all others in place. When the
+// system runs out of watches, the directories left are polled and a
+// WatchLimitError is returned. The other directories it cannot watch are
+// reported with a DirsError.
+func (fw *FSWatcher) SetDirs(dirs []string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	want := map[string]bool{}
+	for _, dir := range dirs {
+		want[dir] = true
+	}
+	// the watches no longer needed are freed first.
+	for dir := range fw.watching {
+		if !want[dir] {
+			// the watch is already gone if the directory was deleted.
+			fw.watcher.Remove(dir)
+			delete(fw.watching, dir)
+		}
+	}
+
+	var limit error
+	var unwatched []string
+	failed := DirsError{}
+	for _, dir := range dirs {
+		if fw.watching[dir] {
+			continue
+		}
+		if limit == nil {
+			err := fw.watcher.Add(dir)
+			if err == nil {
+				fw.watching[dir] = true
+				continue
+			}
+			if !IsWatchLimit(err) {
+				// a directory deleted meanwhile is no longer needed.
+				if !os.IsNotExist(err) {
+					failed[dir] = err
+				}
+				continue
+			}
+			limit = err
+		}
+		unwatched = append(unwatched, dir)
+	}
+
+	switch {
+	case fw.poller != nil:
+		fw.poller.SetDirs(unwatched)
+	case len(unwatched) > 0:
+		fw.poller = NewPoller(unwatched, DefaultPollInterval)
+		fw.senders.Add(1)
+		go fw.forwardPolled(fw.poller)
+	}
+	if limit != nil {
+		return &WatchLimitError{limit, len(dirs), unwatched}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (fw *FSWatcher) Close() error {
+	close(fw.done)
+	fw.mu.Lock()
+	if fw.poller != nil {
+		fw.poller.Close()
+	}
+	fw.mu.Unlock()
+	return fw.watcher.Close()
+}
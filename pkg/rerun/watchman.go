@@ -0,0 +1,139 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rerun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// NewWatchman returns a TreeWatcher using watchman, for repositories too
+// large to watch every directory. It subscribes to the projects watchman
+// finds for dirs, usually the root of the repository, once each.
+func NewWatchman(dirs []string) (*TreeWatcher, error) {
+	_, err := exec.LookPath("watchman")
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var projects []string
+	root := func(dir string, dirs map[string]string) (root string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, project := range projects {
+			if dir == project || strings.HasPrefix(dir, project+string(filepath.Separator)) {
+				return project, nil
+			}
+		}
+		root, err = watchProject(dir)
+		if err == nil {
+			projects = append(projects, root)
+		}
+		return
+	}
+	return newTreeWatcher(dirs, watchmanSubscribe, root)
+}
+
+// a watchmanResponse is a response of watchman, or a notification of a
+// subscription.
+type watchmanResponse struct {
+	Error           string
+	Watch           string
+	IsFreshInstance bool `json:"is_fresh_instance"`
+	Files           []struct {
+		Name   string
+		Exists bool
+		New    bool
+	}
+}
+
+// watchProject makes watchman watch the project of dir, and returns its
+// root.
+func watchProject(dir string) (root string, err error) {
+	out, err := exec.Command("watchman", "--no-pretty", "watch-project", dir).Output()
+	if err != nil {
+		return "", fmt.Errorf("watchman watch-project %s: %s", dir, err)
+	}
+	var resp watchmanResponse
+	err = json.Unmarshal(out, &resp)
+	if err != nil {
+		return
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("watchman watch-project %s: %s", dir, resp.Error)
+	}
+	return filepath.FromSlash(resp.Watch), nil
+}
+
+// watchmanSubscribe subscribes to the changes in the project root, see
+// TreeWatcher.watch.
+func watchmanSubscribe(root string, send func(name string, op Op) bool, done func()) (stop func(), err error) {
+	subscribe, err := json.Marshal([]interface{}{"subscribe", filepath.ToSlash(root), "rerun", map[string]interface{}{
+		"fields":                  []string{"name", "exists", "new"},
+		"empty_on_fresh_instance": true,
+	}})
+	if err != nil {
+		return
+	}
+	cmd := exec.Command("watchman", "--no-pretty", "--persistent", "--json-command")
+	cmd.Stdin = bytes.NewReader(subscribe)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+
+	responses := json.NewDecoder(out)
+	var resp watchmanResponse
+	err = responses.Decode(&resp)
+	if err == nil && resp.Error != "" {
+		err = fmt.Errorf("watchman subscribe %s: %s", root, resp.Error)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return
+	}
+
+	go func() {
+		defer done()
+		defer cmd.Wait()
+		for {
+			var resp watchmanResponse
+			if responses.Decode(&resp) != nil {
+				return
+			}
+			// the files of the first notification are all files.
+			if resp.IsFreshInstance {
+				continue
+			}
+			for _, f := range resp.Files {
+				op := Modify
+				switch {
+				case !f.Exists:
+					op = Delete
+				case f.New:
+					op = Create
+				}
+				if !send(filepath.Join(root, filepath.FromSlash(f.Name)), op) {
+					cmd.Process.Kill()
+					return
+				}
+			}
+		}
+	}()
+	stop = func() {
+		cmd.Process.Kill()
+	}
+	return
+}
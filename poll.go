@@ -0,0 +1,9 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "flag"
+
+var poll_interval = flag.Duration("poll", 0, "Poll for changes at this interval instead of relying on file system notifications")
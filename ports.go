@@ -0,0 +1,127 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// what programs print when the port they listen on is in use.
+var addrInUseRE = regexp.MustCompile(`(?i)address already in use|EADDRINUSE|only one usage of each socket address`)
+
+const (
+	// how long to wait for a port to be freed before starting anyway.
+	portWaitTimeout = 10 * time.Second
+	// how often in a row a program is restarted because its port was in
+	// use.
+	portRetries = 3
+)
+
+// a portGuard keeps a program from dying silently because its port is
+// still held, e.g. by a previous instance that is still shutting down. It
+// waits for the ports before starting the program, and restarts it when
+// it exits complaining about a port in use.
+type portGuard struct {
+	name    string
+	ports   []int
+	retries int
+	// set when the current instance complained about a port in use.
+	inUse int32
+}
+
+// newPortGuard guards the --port ports of the program, moved up by
+// offset.
+func newPortGuard(name string, offset int) (g *portGuard) {
+	g = &portGuard{name: name}
+	for _, p := range worktreePorts {
+		port, err := strconv.Atoi(p[strings.Index(p, "=")+1:])
+		if err == nil {
+			g.ports = append(g.ports, port+offset)
+		}
+	}
+	return
+}
+
+// wrap returns stdout and stderr watching for complaints about a port in
+// use.
+func (g *portGuard) wrap(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	atomic.StoreInt32(&g.inUse, 0)
+	m := &lineMatcher{re: addrInUseRE, matched: func(string) {
+		atomic.StoreInt32(&g.inUse, 1)
+	}}
+	return io.MultiWriter(stdout, m), io.MultiWriter(stderr, m)
+}
+
+// wait waits until the ports are free: for previous instances of the
+// program that are still exiting, and then for the ports themselves.
+func (g *portGuard) wait() {
+	liveChildren.Lock()
+	var previous []*child
+	for c := range liveChildren.m {
+		if c.name == g.name {
+			previous = append(previous, c)
+		}
+	}
+	liveChildren.Unlock()
+	deadline := time.After(portWaitTimeout)
+	for _, c := range previous {
+		log.Printf("waiting for the previous %s (pid %d) to exit", c.name, c.cmd.Process.Pid)
+		select {
+		case <-c.exited:
+		case <-deadline:
+			log.Printf("the previous %s did not exit, starting anyway", c.name)
+			return
+		}
+	}
+
+	for _, port := range g.ports {
+		logged := false
+		for !portFree(port) {
+			if !logged {
+				log.Printf("port %d is in use, waiting for it to be freed", port)
+				logged = true
+			}
+			select {
+			case <-deadline:
+				log.Printf("port %d is still in use, starting anyway", port)
+				return
+			case <-time.After(250 * time.Millisecond):
+			}
+		}
+	}
+}
+
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// exited is called when the program exited by itself, it restarts the
+// program when it failed because a port was in use.
+func (g *portGuard) exited(restart func()) {
+	if atomic.LoadInt32(&g.inUse) == 0 {
+		g.retries = 0
+		return
+	}
+	if g.retries >= portRetries {
+		log.Printf("%s keeps failing with a port in use, giving up", g.name)
+		g.retries = 0
+		return
+	}
+	g.retries++
+	log.Printf("%s failed with a port in use, restarting once it is free (%d/%d)", g.name, g.retries, portRetries)
+	restart()
+}
@@ -0,0 +1,147 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	pprof_kinds   = flag.String("pprof", "", "Comma separated profiles to collect from the program's /debug/pprof on every run, e.g. cpu,mem,goroutine")
+	pprof_url     = flag.String("pprof-url", "", "The program's /debug/pprof, on the host of --ready-url or localhost:6060 by default")
+	pprof_seconds = flag.Int("pprof-seconds", 30, "How long the cpu profile of --pprof runs, from when the program is ready")
+)
+
+// the directory the profiles are written to.
+var profilesDir = filepath.Join(".rerun", "profiles")
+
+// the /debug/pprof endpoints of the kinds of --pprof. cpu is the only
+// one collected while the program runs, the others when it is stopped.
+var pprofEndpoints = map[string]string{
+	"cpu":          "profile",
+	"mem":          "heap",
+	"heap":         "heap",
+	"allocs":       "allocs",
+	"goroutine":    "goroutine",
+	"block":        "block",
+	"mutex":        "mutex",
+	"threadcreate": "threadcreate",
+}
+
+func pprofKinds() (kinds []string) {
+	if *pprof_kinds == "" {
+		return
+	}
+	for _, kind := range strings.Split(*pprof_kinds, ",") {
+		kind = strings.TrimSpace(kind)
+		if _, ok := pprofEndpoints[kind]; !ok {
+			log.Printf("unknown --pprof kind %q", kind)
+			continue
+		}
+		kinds = append(kinds, kind)
+	}
+	return
+}
+
+func pprofBase() string {
+	if *pprof_url != "" {
+		return strings.TrimSuffix(*pprof_url, "/")
+	}
+	if base := baseURL(*ready_url); base != "" {
+		return base + "/debug/pprof"
+	}
+	return "http://localhost:6060/debug/pprof"
+}
+
+// startProfiling collects the cpu profile of c once it is ready, for
+// --pprof-seconds or until it exits.
+func startProfiling(c *child) {
+	for _, kind := range pprofKinds() {
+		if kind != "cpu" {
+			continue
+		}
+		go func() {
+			if !c.waitReady() {
+				return
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				select {
+				case <-c.exited:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			url := fmt.Sprintf("%s/profile?seconds=%d", pprofBase(), *pprof_seconds)
+			err := fetchProfile(ctx, url, c.name, "cpu")
+			if err != nil && ctx.Err() == nil {
+				log.Printf("error on collecting the cpu profile: '%s'\n", err)
+			}
+		}()
+	}
+}
+
+// collectProfiles collects the profiles other than cpu of c, before it is
+// stopped.
+func collectProfiles(c *child) {
+	for _, kind := range pprofKinds() {
+		if kind == "cpu" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := fetchProfile(ctx, pprofBase()+"/"+pprofEndpoints[kind], c.name, kind)
+		cancel()
+		if err != nil {
+			log.Printf("error on collecting the %s profile: '%s'\n", kind, err)
+		}
+	}
+}
+
+// fetchProfile writes the profile at url to profilesDir, named after the
+// program, the time and the kind.
+func fetchProfile(ctx context.Context, url, name, kind string) (err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	err = os.MkdirAll(profilesDir, 0755)
+	if err != nil {
+		return
+	}
+	file := filepath.Join(profilesDir, fmt.Sprintf("%s-%s-%s.pprof", name, time.Now().Format("20060102-150405"), kind))
+	f, err := os.Create(file)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return
+	}
+	log.Printf("wrote %s", file)
+	return
+}
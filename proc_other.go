@@ -0,0 +1,56 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// a procGroup holds the processes started by the program.
+type procGroup struct {
+	p *os.Process
+}
+
+// prepareGroup sets cmd up to be started in its own group.
+func prepareGroup(cmd *exec.Cmd) {}
+
+func newProcGroup(cmd *exec.Cmd) (g *procGroup, err error) {
+	return &procGroup{p: cmd.Process}, nil
+}
+
+// interrupt asks the program to exit.
+func (g *procGroup) interrupt() error {
+	return g.p.Signal(os.Interrupt)
+}
+
+// kill kills the program.
+func (g *procGroup) kill() error {
+	return g.p.Kill()
+}
+
+// close is called once the program exited.
+func (g *procGroup) close() {}
+
+// processAlive reports whether the process pid is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	return err == nil && p.Signal(syscall.Signal(0)) == nil
+}
+
+// detach sets cmd up to keep running when the terminal it was started
+// from goes away.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminate asks rerun running as p to stop its programs and exit.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,155 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procCreateJobObject          = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+)
+
+const (
+	ctrlBreakEvent                  = 1
+	detachedProcess                 = 0x8
+	stillActive                     = 259
+	processSetQuota                 = 0x0100
+	jobObjectExtendedLimitInfoClass = 9
+	jobObjectLimitKillOnJobClose    = 0x2000
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// a procGroup holds the processes started by the program: a console
+// process group to send ctrl-break to, and a job object that takes
+// along the processes the program started when it is killed.
+type procGroup struct {
+	pid uint32
+	job syscall.Handle
+}
+
+// prepareGroup sets cmd up to be started in its own console process
+// group, ctrl-break can only be sent to a whole group.
+func prepareGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// newProcGroup puts the started program in a job object. Processes it
+// starts from now on end up in the job as well.
+func newProcGroup(cmd *exec.Cmd) (g *procGroup, err error) {
+	g = &procGroup{pid: uint32(cmd.Process.Pid)}
+	job, _, e := procCreateJobObject.Call(0, 0)
+	if job == 0 {
+		return g, e
+	}
+	g.job = syscall.Handle(job)
+
+	var info jobObjectExtendedLimitInformation
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	ok, _, e := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInfoClass, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+	if ok == 0 {
+		return g, e
+	}
+
+	h, err := syscall.OpenProcess(processSetQuota|syscall.PROCESS_TERMINATE, false, g.pid)
+	if err != nil {
+		return
+	}
+	defer syscall.CloseHandle(h)
+	ok, _, e = procAssignProcessToJobObject.Call(job, uintptr(h))
+	if ok == 0 {
+		return g, e
+	}
+	return
+}
+
+// interrupt sends ctrl-break to the program, which Go programs receive
+// as os.Interrupt.
+func (g *procGroup) interrupt() error {
+	ok, _, e := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(g.pid))
+	if ok == 0 {
+		return e
+	}
+	return nil
+}
+
+// kill kills the program and the processes it started.
+func (g *procGroup) kill() error {
+	if g.job != 0 {
+		ok, _, e := procTerminateJobObject.Call(uintptr(g.job), 1)
+		if ok == 0 {
+			return e
+		}
+		return nil
+	}
+	p, err := syscall.OpenProcess(syscall.PROCESS_TERMINATE, false, g.pid)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(p)
+	return syscall.TerminateProcess(p, 1)
+}
+
+// close kills the processes the program left behind, once it exited.
+func (g *procGroup) close() {
+	if g.job != 0 {
+		syscall.CloseHandle(g.job)
+		g.job = 0
+	}
+}
+
+// processAlive reports whether the process pid is running.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// detach sets cmd up to run without a console, so it keeps running when
+// the one it was started from is closed.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminate kills rerun running as p. Its job objects are closed with
+// it, which kills its programs.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,143 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"sort"
+	"strings"
+)
+
+// the arguments of the program when none are given on the command line,
+// usually set by a profile.
+var program_args stringList
+
+func init() {
+	flag.Var(&program_args, "arg", "Argument of the program, used when none follow the import path (repeatable)")
+}
+
+// profile commands arrive on the trigger channel with this prefix,
+// followed by the name of the profile, or nothing for the next one.
+const profilePrefix = "profile:"
+
+var (
+	// the config file loaded at startup, nil if it is not rerun's own.
+	loadedConfig *configFile
+	// the profile in use.
+	activeProfile string
+	// the flags given on the command line, which profiles don't override.
+	commandLineFlags = map[string]bool{}
+	// the arguments given on the command line.
+	commandLineArgs []string
+)
+
+// programArgs returns the arguments to run the program with: those given
+// on the command line, those of an air, reflex or realize config, or those
+// of --arg.
+func programArgs(args []string) []string {
+	commandLineArgs = args
+	switch {
+	case len(args) > 0:
+		return args
+	case len(configArgs) > 0:
+		return configArgs
+	}
+	return program_args
+}
+
+// profileCommand returns the profile of a trigger sent by "rerun ctl
+// profile".
+func profileCommand(source string) (name string, ok bool) {
+	if !strings.HasPrefix(source, profilePrefix) {
+		return
+	}
+	return strings.TrimPrefix(source, profilePrefix), true
+}
+
+// nextProfile returns the profile after name, in alphabetical order.
+func (cf configFile) nextProfile(name string) string {
+	names := []string{""}
+	for n := range cf.profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for i, n := range names {
+		if n == name {
+			return names[(i+1)%len(names)]
+		}
+	}
+	return ""
+}
+
+// switchProfile changes the flags from the active profile to the named
+// one, or to the next one if name is empty, and rebuilds and restarts all
+// targets with them. The empty profile is the config without profiles.
+func switchProfile(name string, targets []*target) {
+	if loadedConfig == nil {
+		log.Printf("no %s to switch profiles in", *config_path)
+		return
+	}
+	if name == "" {
+		name = loadedConfig.nextProfile(activeProfile)
+	}
+	p, ok := loadedConfig.profiles[name]
+	if !ok && name != "" {
+		log.Printf("unknown profile %q", name)
+		return
+	}
+
+	keys := map[string]bool{}
+	for key := range loadedConfig.profiles[activeProfile] {
+		keys[key] = true
+	}
+	for key := range p {
+		keys[key] = true
+	}
+	for key := range keys {
+		f := flag.Lookup(key)
+		if f == nil || commandLineFlags[key] {
+			continue
+		}
+		if l, ok := f.Value.(*stringList); ok {
+			*l = nil
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		values, ok := p[key]
+		if !ok {
+			values = loadedConfig.settings[key]
+		}
+		for _, value := range values {
+			err := f.Value.Set(value)
+			if err != nil {
+				log.Printf("error on setting %q: '%s'\n", key, err)
+			}
+		}
+	}
+
+	activeProfile = name
+	if name == "" {
+		log.Println("switched to no profile")
+	} else {
+		log.Printf("switched to profile %s", name)
+	}
+	args := programArgs(commandLineArgs)
+	for _, t := range targets {
+		t.reset(args)
+		t.rebuild()
+	}
+}
+
+// setArgs rebuilds and restarts all targets with other arguments, which
+// are kept when switching profiles.
+func setArgs(args []string, targets []*target) {
+	log.Printf("restarting with %v", args)
+	args = programArgs(args)
+	for _, t := range targets {
+		t.reset(args)
+		t.rebuild()
+	}
+}
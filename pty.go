@@ -0,0 +1,95 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"github.com/ccll/rerun/pkg/rerun"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var use_pty = flag.Bool("pty", false, "Run the program in a pseudo-terminal, so it keeps colors and line buffering (linux and macOS)")
+
+// a pty is the pseudo-terminal a child runs in.
+type pty struct {
+	master, slave *os.File
+	// closed once the output has been copied.
+	copied chan bool
+}
+
+// the ptys of the running children, they are resized along with rerun's
+// terminal.
+var (
+	ptysMu     sync.Mutex
+	ptys       = map[*pty]bool{}
+	resizeOnce sync.Once
+)
+
+// startPty makes cmd run in a new pseudo-terminal. Its output, stdout and
+// stderr merged, goes to what cmd.Stdout was. Keyboard input is not
+// forwarded, without a stdin fixture the program reads from the idle
+// terminal.
+func startPty(cmd *exec.Cmd) (p *pty, err error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return
+	}
+	p = &pty{master: master, slave: slave, copied: make(chan bool)}
+
+	out := cmd.Stdout
+	if out == nil {
+		out = ioutil.Discard
+	}
+	if cmd.Stdin == nil {
+		cmd.Stdin = slave
+	}
+	cmd.Stdout, cmd.Stderr = slave, slave
+	setCtty(cmd)
+
+	resizePty(master)
+	resizeOnce.Do(func() {
+		go func() {
+			for range notifyResize() {
+				ptysMu.Lock()
+				for p := range ptys {
+					resizePty(p.master)
+				}
+				ptysMu.Unlock()
+			}
+		}()
+	})
+	ptysMu.Lock()
+	ptys[p] = true
+	ptysMu.Unlock()
+
+	go func() {
+		io.Copy(out, master)
+		close(p.copied)
+	}()
+	return
+}
+
+// started closes rerun's end of the terminal, once the child has its own.
+func (p *pty) started() {
+	p.slave.Close()
+}
+
+// close waits for the output to be copied, which stops when the last
+// process using the terminal exits, and closes the terminal.
+func (p *pty) close() {
+	select {
+	case <-p.copied:
+	case <-time.After(rerun.SettleTime):
+	}
+	ptysMu.Lock()
+	delete(ptys, p)
+	ptysMu.Unlock()
+	p.master.Close()
+}
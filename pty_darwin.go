@@ -0,0 +1,42 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPty opens a new pseudo-terminal, as posix_openpt, grantpt, unlockpt
+// and ptsname do.
+func openPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+	var name [128]byte
+	err = ioctl(master.Fd(), syscall.TIOCPTYGRANT, 0)
+	if err == nil {
+		err = ioctl(master.Fd(), syscall.TIOCPTYUNLK, 0)
+	}
+	if err == nil {
+		err = ioctl(master.Fd(), syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0])))
+	}
+	if err == nil {
+		if n := bytes.IndexByte(name[:], 0); n >= 0 {
+			slave, err = os.OpenFile(string(name[:n]), os.O_RDWR|syscall.O_NOCTTY, 0)
+		}
+	}
+	if err == nil && slave == nil {
+		err = syscall.EINVAL
+	}
+	if err != nil {
+		master.Close()
+		master = nil
+	}
+	return
+}
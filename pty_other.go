@@ -0,0 +1,31 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func openPty() (master, slave *os.File, err error) {
+	err = errors.New("--pty is only supported on linux and macOS")
+	return
+}
+
+func setCtty(cmd *exec.Cmd) {}
+
+func resizePty(master *os.File) {}
+
+func terminalSize() (cols, rows int) {
+	return 80, 24
+}
+
+func notifyResize() <-chan os.Signal {
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	rows, cols, x, y uint16
+}
+
+func ioctl(fd, request, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setCtty makes the terminal on the child's stdout its controlling one.
+func setCtty(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 1}
+}
+
+// resizePty gives the pseudo-terminal the size of rerun's terminal.
+func resizePty(master *os.File) {
+	var ws winsize
+	if ioctl(originalFile(os.Stdout).Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))) != nil {
+		return
+	}
+	ioctl(master.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// terminalSize returns the size of rerun's terminal, or 80x24.
+func terminalSize() (cols, rows int) {
+	var ws winsize
+	if ioctl(originalFile(os.Stdout).Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))) != nil || ws.cols == 0 {
+		return 80, 24
+	}
+	return int(ws.cols), int(ws.rows)
+}
+
+// notifyResize reports when rerun's terminal is resized.
+func notifyResize() <-chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGWINCH)
+	return c
+}
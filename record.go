@@ -0,0 +1,153 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var record_path = flag.String("record", "", "Record rerun's output with its timing to this file, in asciinema's format")
+
+// the original stdout and stderr by the pipes that replace them while
+// recording.
+var recordedFiles = map[*os.File]*os.File{}
+
+// originalFile returns the file f stands in for while recording, or f.
+func originalFile(f *os.File) *os.File {
+	if orig, ok := recordedFiles[f]; ok {
+		return orig
+	}
+	return f
+}
+
+// a recorder writes an asciicast v2 file: a header line, then one
+// [seconds, "o", data] line per output.
+type recorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	start time.Time
+	// an incomplete UTF-8 sequence at the end of the last output.
+	partial []byte
+}
+
+// startRecording records everything written to stdout and stderr from now
+// on, by rerun and the programs it runs, to path. A rerun restarted by
+// --reexec continues the recording.
+func startRecording(path string) (err error) {
+	r := &recorder{start: time.Now()}
+	if os.Getenv(reexecEnv) != "" {
+		r.f, r.start, err = continueRecording(path)
+	} else {
+		r.f, err = newRecording(path, r.start)
+	}
+	if err != nil {
+		return
+	}
+
+	stdout, err := r.tee(os.Stdout)
+	if err != nil {
+		return
+	}
+	stderr, err := r.tee(os.Stderr)
+	if err != nil {
+		return
+	}
+	os.Stdout, os.Stderr = stdout, stderr
+	log.SetOutput(os.Stderr)
+	log.Printf("recording to %s", path)
+	return
+}
+
+// newRecording creates the recording and writes its header.
+func newRecording(path string, start time.Time) (f *os.File, err error) {
+	f, err = os.Create(path)
+	if err != nil {
+		return
+	}
+	cols, rows := terminalSize()
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     cols,
+		"height":    rows,
+		"timestamp": start.Unix(),
+		"env":       map[string]string{"SHELL": os.Getenv("SHELL"), "TERM": os.Getenv("TERM")},
+	})
+	_, err = f.Write(append(header, '\n'))
+	return
+}
+
+// continueRecording opens a recording to append to, and returns when it
+// was started.
+func continueRecording(path string) (f *os.File, start time.Time, err error) {
+	f, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	var header struct {
+		Timestamp int64 `json:"timestamp"`
+	}
+	line, _ := bufio.NewReader(f).ReadBytes('\n')
+	err = json.Unmarshal(line, &header)
+	if err != nil {
+		f.Close()
+		return nil, start, fmt.Errorf("%s: %s", path, err)
+	}
+	start = time.Unix(header.Timestamp, 0)
+	return
+}
+
+// tee returns a pipe whose data goes to orig and to the recording.
+func (r *recorder) tee(orig *os.File) (w *os.File, err error) {
+	pr, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	recordedFiles[w] = orig
+	go io.Copy(io.MultiWriter(orig, r), pr)
+	return
+}
+
+func (r *recorder) Write(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	// keep back a character that is split between writes.
+	r.partial = nil
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				r.partial = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if len(data) == 0 {
+		return len(p), nil
+	}
+
+	// a terminal turns newlines into carriage return and newline, the
+	// player doesn't.
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	data = bytes.Replace(data, []byte("\n"), []byte("\r\n"), -1)
+
+	line, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), "o", string(data)})
+	_, err = r.f.Write(append(line, '\n'))
+	if err != nil {
+		log.Printf("error on recording: '%s'\n", err)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"github.com/ccll/rerun/pkg/rerun"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+var self_reexec = flag.Bool("reexec", false, "Restart rerun itself when its executable is rebuilt (not on windows)")
+
+// set in the environment of a restarted rerun.
+const reexecEnv = "RERUN_REEXEC"
+
+// how often rerun's executable is checked for changes.
+const selfCheckInterval = 2 * time.Second
+
+// watchSelf checks whether rerun's executable changes. Then rerun restarts
+// itself with the same arguments when --reexec is given, or else says
+// that it could.
+func watchSelf() {
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return
+	}
+	go func() {
+		for range time.Tick(selfCheckInterval) {
+			nfi, err := os.Stat(exe)
+			if err != nil || (nfi.ModTime().Equal(fi.ModTime()) && nfi.Size() == fi.Size()) {
+				continue
+			}
+			fi = nfi
+			// wait for the new binary to be written completely.
+			time.Sleep(rerun.SettleTime)
+			if !*self_reexec {
+				log.Printf("%s was rebuilt, restart rerun (or use --reexec) to use it", exe)
+				continue
+			}
+			reexec(exe)
+		}
+	}()
+}
+
+// reexec stops the programs and replaces rerun with a new instance of
+// exe, with the same arguments and environment. The programs are set up
+// again by the new instance, only a recording is continued.
+func reexec(exe string) {
+	log.Printf("%s was rebuilt, restarting rerun", exe)
+	stopAll()
+	restoreTerminal()
+	err := syscall.Exec(exe, os.Args, append(os.Environ(), reexecEnv+"=1"))
+	log.Printf("error on restarting rerun: '%s'\n", err)
+	exitRerun(1)
+}
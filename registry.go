@@ -0,0 +1,154 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	register_cmd   = flag.String("register", "", "Shell command registering the program with a service registry or load balancer once it is ready")
+	deregister_cmd = flag.String("deregister", "", "Shell command deregistering the program before it is stopped")
+	ready_url      = flag.String("ready-url", "", "URL that answers with 2xx once the program is ready, checked before --register")
+	ready_timeout  = flag.Duration("ready-timeout", 30*time.Second, "How long to wait for --ready-url")
+)
+
+// a registration keeps track of whether the instance of the program in c
+// is registered with the --register command.
+type registration struct {
+	c *child
+
+	mu         sync.Mutex
+	registered bool
+	canceled   bool
+}
+
+// startRegistration registers c as soon as it is ready. It returns nil
+// when no registry commands are configured.
+func startRegistration(c *child) (r *registration) {
+	if *register_cmd == "" && *deregister_cmd == "" {
+		return
+	}
+	r = &registration{c: c}
+	go r.register()
+	return
+}
+
+func (r *registration) register() {
+	if *ready_url != "" && !r.waitReady() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.canceled {
+		return
+	}
+	if *register_cmd != "" {
+		err := r.runHook(*register_cmd)
+		if err != nil {
+			log.Printf("error on registering: '%s'\n", err)
+			return
+		}
+		log.Println("registered")
+	}
+	r.registered = true
+}
+
+// waitReady waits until the program is ready, see child.waitReady.
+func (r *registration) waitReady() bool {
+	if !r.c.waitReady() {
+		log.Printf("%s is not ready, not registering", r.c.name)
+		return false
+	}
+	return true
+}
+
+// waitReady polls --ready-url until it succeeds. It returns false when the
+// program exits or doesn't get ready in time. All callers share one poll.
+func (c *child) waitReady() bool {
+	c.readyOnce.Do(func() {
+		c.readyDone = make(chan bool)
+		go func() {
+			c.ready = c.pollReady()
+			close(c.readyDone)
+		}()
+	})
+	<-c.readyDone
+	return c.ready
+}
+
+func (c *child) pollReady() bool {
+	if *ready_url == "" {
+		return true
+	}
+	deadline := time.Now().Add(*ready_timeout)
+	done := timePhase("ready")
+	for {
+		resp, err := http.Get(*ready_url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				log.Printf("ready %s", roundDuration(done()))
+				return true
+			}
+		}
+		if time.Now().After(deadline) {
+			log.Printf("%s did not get ready within %s", c.name, *ready_timeout)
+			return false
+		}
+		select {
+		case <-c.exited:
+			return false
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// cancel deregisters the program, or makes sure it won't be registered
+// anymore if it is not yet.
+func (r *registration) cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canceled = true
+	if !r.registered || *deregister_cmd == "" {
+		return
+	}
+	err := r.runHook(*deregister_cmd)
+	if err != nil {
+		log.Printf("error on deregistering: '%s'\n", err)
+		return
+	}
+	log.Println("deregistered")
+}
+
+// runHook runs a registry command, with the pid of the program in
+// $RERUN_PID.
+func (r *registration) runHook(cmdline string) (err error) {
+	cmd := shellCommand(cmdline)
+	// the hooks get the secrets, e.g. tokens of the registry.
+	senv, err := secretEnv()
+	if err != nil {
+		return
+	}
+	cmd.Env = append(os.Environ(), senv...)
+	cmd.Env = append(cmd.Env, "RERUN_PID="+strconv.Itoa(r.c.cmd.Process.Pid))
+	buf := bytes.NewBuffer([]byte{})
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("%s: %s", err, bytes.TrimSpace(buf.Bytes()))
+	}
+	return
+}
@@ -0,0 +1,52 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+)
+
+var reload_signal = flag.String("reload-signal", "SIGHUP", "Signal sent to the program for the changes of '(reload)' rules, instead of restarting it")
+
+// the command of rules that send --reload-signal to the program.
+const reloadProgram = "(reload)"
+
+// reloadChildren sends --reload-signal to the running programs called
+// name, including its --instances. It reports false when none is running
+// or the signal can't be sent, they need to be restarted then.
+func reloadChildren(name string) (reloaded bool) {
+	sig, err := parseSignal(*reload_signal)
+	if err != nil {
+		log.Printf("error on parsing --reload-signal: '%s'\n", err)
+		return
+	}
+	liveChildren.Lock()
+	defer liveChildren.Unlock()
+	for c := range liveChildren.m {
+		if c.name != name && !strings.HasPrefix(c.name, name+"#") {
+			continue
+		}
+		err := c.cmd.Process.Signal(sig)
+		if err != nil {
+			log.Printf("error on sending %s to %s: '%s'\n", *reload_signal, c.name, err)
+			return false
+		}
+		reloaded = true
+	}
+	if reloaded {
+		log.Printf("sent %s to %s", *reload_signal, name)
+	}
+	return
+}
+
+// reload sends --reload-signal to the program, or restarts it when that
+// isn't possible.
+func (t *target) reload() {
+	if !reloadChildren(targetName(t.buildpath)) {
+		t.restart()
+	}
+}
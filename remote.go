@@ -0,0 +1,113 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	remote_target      = flag.String("remote", "", "Run the program on another host, given as user@host:/path/of/the/binary: every build is built for Linux, copied there with scp and restarted")
+	remote_restart_cmd = flag.String("remote-restart-cmd", "", "Command restarting the program on the --remote host, e.g. 'systemctl restart app'; without it rerun runs the binary over ssh")
+	remote_logs_cmd    = flag.String("remote-logs-cmd", "", "Command printing the output of the program on the --remote host, e.g. 'journalctl -fu app', for --remote-restart-cmd")
+	remote_goarch      = flag.String("remote-goarch", "", "GOARCH of the --remote host, asked with uname by default")
+)
+
+// the directory the binaries for --remote are built in.
+var remoteBinDir = filepath.Join(".rerun", "remote")
+
+// the GOARCH of the machines uname -m names.
+var unameArch = map[string]string{
+	"x86_64":  "amd64",
+	"i686":    "386",
+	"i386":    "386",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv7l":  "arm",
+	"armv6l":  "arm",
+	"riscv64": "riscv64",
+}
+
+// runRemote copies the program to the --remote host on every launch and
+// restarts it there, streaming its output.
+func runRemote(buildpath, binName string, args []string) (runch chan bool) {
+	return runDeployed(binName, "remote", func() (cmd *exec.Cmd, err error) {
+		host, binPath, err := deployRemote(buildpath, binName)
+		if err != nil {
+			return
+		}
+		if *remote_restart_cmd == "" {
+			// with a terminal, the program is hung up on when ssh is
+			// stopped.
+			return exec.Command("ssh", "-tt", host, shellQuote(append([]string{binPath}, args...))), nil
+		}
+		err = runTool("ssh", host, *remote_restart_cmd)
+		if err != nil {
+			return
+		}
+		if *remote_logs_cmd == "" {
+			return
+		}
+		return exec.Command("ssh", host, *remote_logs_cmd), nil
+	})
+}
+
+// deployRemote builds the binary for the --remote host and copies it
+// there, replacing the old one only once it was copied completely.
+func deployRemote(buildpath, binName string) (host, binPath string, err error) {
+	colon := strings.Index(*remote_target, ":")
+	if colon < 0 {
+		err = fmt.Errorf("expected --remote=user@host:/path/of/the/binary, got %q", *remote_target)
+		return
+	}
+	host, binPath = (*remote_target)[:colon], (*remote_target)[colon+1:]
+	if strings.HasSuffix(binPath, "/") {
+		binPath = path.Join(binPath, binName)
+	}
+
+	arch := *remote_goarch
+	if arch == "" {
+		arch = *target_goarch
+	}
+	if arch == "" {
+		var machine string
+		machine, err = runQuiet("ssh", host, shellQuote([]string{"uname", "-m"}))
+		if err != nil {
+			err = fmt.Errorf("asking %s for its architecture: %s: %s", host, err, strings.TrimSpace(machine))
+			return
+		}
+		var ok bool
+		arch, ok = unameArch[strings.TrimSpace(machine)]
+		if !ok {
+			err = fmt.Errorf("unknown architecture %q of %s, give it with --remote-goarch", strings.TrimSpace(machine), host)
+			return
+		}
+	}
+	localBin := filepath.Join(remoteBinDir, binName)
+	err = buildForLinux(buildpath, localBin, arch)
+	if err != nil {
+		return
+	}
+	err = runTool("scp", "-q", localBin, host+":"+binPath+".new")
+	if err != nil {
+		return
+	}
+	err = runTool("ssh", host, shellQuote([]string{"mv", binPath + ".new", binPath}))
+	return
+}
+
+// shellQuote quotes args for the remote shell.
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,105 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"log"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var remote_build = flag.String("remote-build", "", "Build on another host instead of locally, given as user@host:/path/to/workspace")
+
+// remoteInstall builds the binary of buildpath for the target platform on
+// the --remote-build host, for hosts too weak to compile quickly. The
+// module of buildpath, or its GOPATH workspace, is synced to the remote
+// workspace first, and the binary is copied back to where go install
+// would have put it.
+func remoteInstall(buildpath string) (installed bool, err error) {
+	colon := strings.Index(*remote_build, ":")
+	if colon < 0 {
+		err = fmt.Errorf("expected --remote-build=user@host:/path/to/workspace, got %q", *remote_build)
+		return
+	}
+	host, workspace := (*remote_build)[:colon], (*remote_build)[colon+1:]
+
+	pkg, err := build.Import(buildpath, "", build.FindOnly)
+	if err != nil {
+		return
+	}
+	_, binPath := binaryPath(buildpath, pkg)
+	remoteBin := path.Join(workspace, "bin", build.Default.GOOS+"_"+build.Default.GOARCH, path.Base(buildpath))
+
+	// the local tree to sync, and where to build in the remote one.
+	var local, dir string
+	env := []string{"GOOS=" + build.Default.GOOS, "GOARCH=" + build.Default.GOARCH}
+	if root := findModuleRoot(pkg.Dir); root != "" {
+		var rel string
+		rel, err = filepath.Rel(root, pkg.Dir)
+		if err != nil {
+			return
+		}
+		local = root
+		dir = path.Join(workspace, "src", filepath.ToSlash(rel))
+	} else if pkg.Root != "" {
+		local = filepath.Join(pkg.Root, "src")
+		dir = workspace
+		env = append(env, "GOPATH="+workspace, "GO111MODULE=off")
+	} else {
+		err = errors.New("can only build packages of a module or a GOPATH workspace remotely")
+		return
+	}
+
+	out, err := runQuiet("rsync", "-az", "--delete", "--exclude=.git", local+"/", host+":"+path.Join(workspace, "src")+"/")
+	if err != nil {
+		fmt.Print(out)
+		err = fmt.Errorf("syncing to %s: %s", host, err)
+		return
+	}
+
+	gocmd := []string{"env"}
+	gocmd = append(gocmd, env...)
+	gocmd = append(gocmd, build_env...)
+	gocmd = append(gocmd, "go", "build", "-o", remoteBin)
+	gocmd = append(gocmd, buildFlags(pkg)...)
+	gocmd = append(gocmd, buildpath)
+	remote := "cd " + shellQuote([]string{dir}) + " && " + shellQuote(gocmd)
+	out, err = runQuiet("ssh", host, remote)
+	if err != nil {
+		reportBuildOutput(out)
+		err = errors.New("compile error")
+		return
+	}
+
+	out, err = runQuiet("scp", "-q", host+":"+remoteBin, binPath)
+	if err != nil {
+		fmt.Print(out)
+		err = fmt.Errorf("copying binary from %s: %s", host, err)
+		return
+	}
+
+	log.Printf("built on %s", host)
+	buildSucceeded()
+	installed = true
+	return
+}
+
+// runQuiet runs a command and returns its combined output.
+func runQuiet(name string, args ...string) (out string, err error) {
+	cmd := exec.Command(name, args...)
+	buf := bytes.NewBuffer([]byte{})
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+	err = cmd.Run()
+	out = buf.String()
+	return
+}
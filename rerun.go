@@ -6,100 +6,210 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/howeyc/fsnotify"
+	"github.com/ccll/rerun/pkg/rerun"
 	"go/build"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	do_tests      = flag.Bool("test", false, "Run tests (before running program)")
-	do_build      = flag.Bool("build", false, "Build program")
-	never_run     = flag.Bool("no-run", false, "Do not run")
-	race_detector = flag.Bool("race", false, "Run program and tests with the race detector")
+	do_tests       = flag.Bool("test", false, "Run tests (before running program)")
+	do_build       = flag.Bool("build", false, "Build program")
+	never_run      = flag.Bool("no-run", false, "Do not run")
+	race_detector  = flag.Bool("race", false, "Run program and tests with the race detector")
+	build_tags     = flag.String("tags", "", "Build tags for building and testing, e.g. tracing,sqlite")
+	skip_identical = flag.Bool("skip-identical", false, "Do not restart the program when the rebuilt binary is identical")
+	vcs_hooks      = flag.Bool("vcs-hooks", false, "Do not watch files, rebuild only when triggered with 'rerun ctl trigger' (e.g. from git hooks)")
 )
 
+// more main packages to build and run, usually listed in the config file.
+var target_paths stringList
+
+func init() {
+	flag.Var(&target_paths, "target", "Import path of another program to build and run (repeatable)")
+}
+
+// a stringList is a flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func install(buildpath string) (installed bool, err error) {
-	cmdline := []string{"go", "get"}
+	if *remote_build != "" {
+		return remoteInstall(buildpath)
+	}
 
-	if *race_detector {
-		cmdline = append(cmdline, "-race")
+	pkg, err := build.Import(buildpath, "", build.FindOnly)
+	if err != nil {
+		return
 	}
+	_, binPath := binaryPath(buildpath, pkg)
+	cmdline := []string{"go", "build", "-o", binPath}
+	cmdline = append(cmdline, buildFlags(pkg)...)
 	cmdline = append(cmdline, buildpath)
 
 	// setup the build command, use a shared buffer for both stdOut and stdErr
 	cmd := exec.Command("go", cmdline[1:]...)
+	cmd.Env = buildEnv()
 	buf := bytes.NewBuffer([]byte{})
 	cmd.Stdout = buf
 	cmd.Stderr = buf
 
-	err = cmd.Run()
+	err = runTimeout(cmd, *build_timeout, "go build")
+	if _, ok := err.(timeoutError); ok {
+		return
+	}
 
-	// when there is any output, the go command failed.
-	if buf.Len() > 0 {
-		fmt.Print(buf.String())
-		err = errors.New("compile error")
+	// the exit code tells whether the build failed, the output is only
+	// shown. A build can fail without output, or succeed with warnings.
+	if err != nil {
+		if buf.Len() > 0 {
+			reportBuildOutput(buf.String())
+		}
 		return
 	}
+	if buf.Len() > 0 {
+		fmt.Print(buf)
+	}
 
 	// all seems fine
+	buildSucceeded()
 	installed = true
 	return
 }
 
+// buildFlags returns the flags of go build for pkg, wherever it is built.
+func buildFlags(pkg *build.Package) (flags []string) {
+	// go.mod and go.sum are only changed when asked for, which keeps
+	// builds off the network.
+	if findModuleRoot(pkg.Dir) != "" && !*allow_mod_changes {
+		flags = append(flags, "-mod=readonly")
+	}
+	if *race_detector {
+		flags = append(flags, "-race")
+	}
+	flags = append(flags, debugBuildFlags()...)
+	if *build_tags != "" {
+		flags = append(flags, "-tags", *build_tags)
+	}
+	return
+}
+
+// test runs the tests of buildpath. The tests that failed last time run
+// first, failing fast, before the whole suite.
 func test(buildpath string) (passed bool, err error) {
+	if failed := loadFailedTests(buildpath); len(failed) > 0 {
+		infof("running the %d test(s) that failed last time first", len(failed))
+		passed, err = runTests(buildpath, "-failfast", "-run=^("+strings.Join(failed, "|")+")$")
+		if !passed {
+			return
+		}
+	}
+
+	cover := coverArgs()
+	passed, err = runTests(buildpath, cover...)
+	if !passed {
+		return
+	}
+	if *test_in_docker != "" {
+		infof("tests passed in %s", *test_in_docker)
+	} else {
+		infof("tests passed")
+	}
+	if len(cover) > 0 {
+		updateCoverage()
+	}
+
+	return
+}
+
+// runTests runs go test -json with the extra arguments, printing its
+// report and remembering the tests that failed.
+func runTests(buildpath string, extra ...string) (passed bool, err error) {
 	cmdline := []string{"go", "test"}
 
 	if *race_detector {
 		cmdline = append(cmdline, "-race")
 	}
-	cmdline = append(cmdline, "-v", buildpath)
+	if *build_tags != "" {
+		cmdline = append(cmdline, "-tags", *build_tags)
+	}
+	cmdline = append(cmdline, extra...)
+	cmdline = append(cmdline, "-json", buildpath)
 
 	// setup the build command, use a shared buffer for both stdOut and stdErr
 	cmd := exec.Command("go", cmdline[1:]...)
+	cmd.Env = buildEnv()
+	if *test_in_docker != "" {
+		cmd, err = dockerTestCommand(buildpath, cmdline[1:])
+		if err != nil {
+			log.Print(err)
+			return
+		}
+	}
 	buf := bytes.NewBuffer([]byte{})
 	cmd.Stdout = buf
 	cmd.Stderr = buf
 
-	err = cmd.Run()
+	err = runTimeout(cmd, *test_timeout, "go test")
+	if _, ok := err.(timeoutError); ok {
+		log.Printf("%s, keeping the running program", err)
+		return
+	}
 	passed = err == nil
 
-	if !passed {
-		fmt.Println(buf)
-	} else {
-		log.Println("tests passed")
-	}
+	report := parseTestEvents(buf.Bytes())
+	saveFailedTests(buildpath, report.failed)
+	report.print()
 
 	return
 }
 
 func gobuild(buildpath string) (passed bool, err error) {
-	cmdline := []string{"go", "build"}
-
-	if *race_detector {
-		cmdline = append(cmdline, "-race")
+	pkg, err := build.Import(buildpath, "", build.FindOnly)
+	if err != nil {
+		log.Print(err)
+		return
 	}
+	cmdline := []string{"go", "build"}
+	cmdline = append(cmdline, buildFlags(pkg)...)
 	cmdline = append(cmdline, "-v", buildpath)
 
 	// setup the build command, use a shared buffer for both stdOut and stdErr
 	cmd := exec.Command("go", cmdline[1:]...)
+	cmd.Env = buildEnv()
 	buf := bytes.NewBuffer([]byte{})
 	cmd.Stdout = buf
 	cmd.Stderr = buf
 
+	logCommand(cmd)
 	err = cmd.Run()
 	passed = err == nil
 
 	if !passed {
 		fmt.Println(buf)
 	} else {
-		log.Println("build passed")
+		infof("build passed")
 	}
 
 	return
@@ -109,163 +219,668 @@ func run(binName, binPath string, args []string) (runch chan bool) {
 	runch = make(chan bool)
 	go func() {
 		cmdline := append([]string{binName}, args...)
-		var proc *os.Process
+		restart := func() {
+			restartLater(runch)
+		}
+		var proc *child
+		var reg *registration
+		var suite *suiteRun
+		ports := newPortGuard(binName, 0)
 		for relaunch := range runch {
+			if suite != nil {
+				suite.cancel()
+				suite = nil
+			}
+			if reg != nil {
+				reg.cancel()
+				reg = nil
+			}
 			if proc != nil {
-				err := proc.Signal(os.Interrupt)
-				if err != nil {
-					log.Printf("error on sending signal to process: '%s', will now hard-kill the process\n", err)
-					proc.Kill()
-				}
-				proc.Wait()
+				collectProfiles(proc)
+				proc.stop()
+				proc = nil
 			}
 			if !relaunch {
 				continue
 			}
-			cmd := exec.Command(binPath, args...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			waitForServices()
+			waitForDevices()
+			ports.wait()
+			waitStartDelay()
+			var stdout io.Writer = os.Stdout
+			afterExit := func() {
+				ports.exited(restart)
+			}
+			if *golden_dir != "" {
+				golden := newGoldenOutput(binName, nil)
+				stdout = io.MultiWriter(os.Stdout, golden)
+				afterExit = func() {
+					golden.compare()
+					ports.exited(restart)
+				}
+			}
+			stdout, stderr := ports.wrap(stdout, os.Stderr)
+			stdout, stderr = watchOutput(stdout, stderr, restart)
+			cmd, err := childCommand(binPath, args, nextStdinFixture(), stdout, stderr)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
 			log.Print(cmdline)
-			err := cmd.Start()
+			done := timePhase("start")
+			proc, err = startChild(binName, cmd, afterExit)
 			if err != nil {
 				log.Printf("error on starting process: '%s'\n", err)
+				continue
 			}
-			proc = cmd.Process
+			if d := done(); *ready_url == "" {
+				infof("start %s", roundDuration(d))
+			}
+			if *debug_mode {
+				log.Printf("debugger listening on %s", *debug_addr)
+			}
+			emit(eventRunStart, binName, strconv.Itoa(proc.cmd.Process.Pid))
+			emit(eventState, binName, stateRunning)
+			supervise(proc, restart)
+			startProfiling(proc)
+			reg = startRegistration(proc)
+			suite = startIntegration(proc)
 		}
 	}()
 	return
 }
 
-func getWatcher(buildpath string) (watcher *fsnotify.Watcher, err error) {
-	watcher, err = fsnotify.NewWatcher()
-	addToWatcher(watcher, buildpath, map[string]bool{})
+// binaryPath returns where go install puts the binary of buildpath.
+func binaryPath(buildpath string, pkg *build.Package) (binName, binPath string) {
+	_, binName = path.Split(buildpath)
+	switch gobin := os.Getenv("GOBIN"); {
+	case gobin != "":
+		binPath = filepath.Join(gobin, binName)
+	case isCrossBuild():
+		// go install puts binaries for other platforms apart.
+		binPath = filepath.Join(pkg.BinDir, build.Default.GOOS+"_"+build.Default.GOARCH, binName)
+	default:
+		binPath = filepath.Join(pkg.BinDir, binName)
+	}
+	if build.Default.GOOS == "windows" {
+		binPath += ".exe"
+	}
 	return
 }
 
-func addToWatcher(watcher *fsnotify.Watcher, importpath string, watching map[string]bool) {
-	pkg, _ := build.Import(importpath, "", 0)
-	if pkg.Goroot {
+// checkMain checks that buildpath is a main package that can be run.
+func checkMain(buildpath string) (pkg *build.Package, err error) {
+	pkg, err = build.Import(buildpath, "", 0)
+	if err != nil {
 		return
 	}
-	watcher.Watch(pkg.Dir)
-	watching[importpath] = true
-	for _, imp := range pkg.Imports {
-		if !watching[imp] {
-			addToWatcher(watcher, imp, watching)
+
+	if pkg.Name != "main" {
+		err = fmt.Errorf("expected package %q, got %q", "main", pkg.Name)
+		return
+	}
+
+	if *child_dir != "" {
+		if fi, err := os.Stat(*child_dir); err != nil || !fi.IsDir() {
+			return pkg, fmt.Errorf("cannot run in %s: not a directory", *child_dir)
 		}
 	}
+
+	err = checkHardware()
+	return
 }
 
 func setup(buildpath string, args []string) (runch chan bool, succ bool) {
-	log.Printf("setting up %s %v", buildpath, args)
+	infof("setting up %s %v", buildpath, args)
 
-	pkg, err := build.Import(buildpath, "", 0)
+	pkg, err := checkMain(buildpath)
 	if err != nil {
 		log.Print(err.Error())
 		succ = false
 		return
 	}
 
-	if pkg.Name != "main" {
-		log.Printf("expected package %q, got %q", "main", pkg.Name)
+	binName, binPath := binaryPath(buildpath, pkg)
+
+	variants, err := argsMatrix()
+	if err != nil {
+		log.Print(err)
 		succ = false
 		return
 	}
 
-	_, binName := path.Split(buildpath)
-	var binPath string
-	if gobin := os.Getenv("GOBIN"); gobin != "" {
-		binPath = filepath.Join(gobin, binName)
-	} else {
-		binPath = filepath.Join(pkg.BinDir, binName)
-	}
-
 	if !(*never_run) {
-		runch = run(binName, binPath, args)
+		if *wasm_mode {
+			runch = runWasm(binName, binPath, pkg.Dir)
+		} else if *docker_container != "" {
+			runch = runInContainer(buildpath, binName)
+		} else if *k8s_deploy != "" {
+			runch = runInCluster(buildpath, binName)
+		} else if *remote_target != "" {
+			runch = runRemote(buildpath, binName, args)
+		} else if variants != nil {
+			runch = runMatrix(binName, binPath, args, variants)
+		} else if *instances > 1 {
+			runch = runInstances(binName, binPath, args)
+		} else {
+			runch = run(binName, binPath, args)
+		}
 	}
 
 	succ = true
 	return
 }
 
-func buildTestRun(buildpath string, runch chan bool) {
+// the hashes of the binaries that were last (re)started, by import path,
+// for --skip-identical.
+var runningBinaries = map[string][sha256.Size]byte{}
+
+// buildTestRun builds and tests buildpath, and restarts it with runch
+// unless that is nil. passed reports whether building and testing passed.
+func buildTestRun(buildpath string, runch chan bool) (passed bool) {
+	name := targetName(buildpath)
+
 	// rebuild
-	installed, _ := install(buildpath)
-	if !installed {
-		return
+	var phases phaseLog
+	result, firstErr := "passed", ""
+	defer func() {
+		phases.print()
+		recordCycle(name, phases, result, firstErr)
+		if result != "passed" && *exit_on_build_error && !*run_once {
+			exitRerun(1)
+		}
+	}()
+
+	emit(eventBuildStart, name, "")
+	emit(eventState, name, stateBuilding)
+
+	var binHash [sha256.Size]byte
+	steps := stageSteps("build")
+	steps = append(steps, rerun.Step{Name: "build", Run: func() error {
+		firstError = ""
+		installed, err := install(buildpath)
+		if !installed {
+			msg := ""
+			if err != nil {
+				msg = err.Error()
+				if firstError == "" {
+					log.Printf("error on building %s: '%s'\n", buildpath, err)
+				}
+			}
+			result, firstErr = "build_failed", firstError
+			if firstError != "" {
+				msg = firstError
+			} else {
+				firstErr = msg
+			}
+			emit(eventBuildFailed, name, msg)
+			return errors.New("build failed")
+		}
+		emit(eventBuildPassed, name, "")
+
+		if *skip_identical {
+			pkg, _ := build.Import(buildpath, "", build.FindOnly)
+			_, binPath := binaryPath(buildpath, pkg)
+			binHash, _ = hashFile(binPath)
+		}
+		return nil
+	}})
+	steps = append(steps, stageSteps("test")...)
+	if *do_tests && shouldRun("test") {
+		steps = append(steps, rerun.Step{Name: "tests", Run: func() error {
+			emit(eventState, name, stateTesting)
+			if passed, _ := test(buildpath); !passed {
+				result = "test_failed"
+				emit(eventTestFailed, name, "")
+				return errors.New("tests failed")
+			}
+			emit(eventTestPassed, name, "")
+			return nil
+		}})
+	}
+	if *bench_re != "" && shouldRun("bench") {
+		steps = append(steps, rerun.Step{Name: "benchmarks", Run: func() error {
+			runBenchmarks(buildpath)
+			return nil
+		}})
+	}
+	if *fuzz_target != "" && shouldRun("fuzz") {
+		steps = append(steps, rerun.Step{Name: "fuzzing", Run: func() error {
+			runFuzz(buildpath)
+			return nil
+		}})
 	}
+	if *do_build && shouldRun("build") {
+		steps = append(steps, rerun.Step{Name: "go build", Run: func() error {
+			gobuild(buildpath)
+			return nil
+		}})
+	}
+	steps = append(steps, stageSteps("run")...)
 
-	if *do_tests {
-		passed, _ := test(buildpath)
-		if !passed {
-			return
+	pipeline := &rerun.Pipeline{
+		Steps: steps,
+		OnStep: func(step string, d time.Duration, err error) {
+			recordPhase(step, d)
+			phases.add(step, d)
+		},
+	}
+	if pipeline.Run() != nil {
+		// the built-in steps say how they failed, the stages don't.
+		if result == "passed" {
+			result = "phase_failed"
 		}
+		emit(eventState, name, stateFailed)
+		return
 	}
+	if *integration_cmd != "" {
+		skipIntegration.Lock()
+		skipIntegration.m[name] = !shouldRun("integration")
+		skipIntegration.Unlock()
+	}
+	passed = true
 
-	if *do_build {
-		gobuild(buildpath)
+	// rerun. if we're only testing, there is nothing to run.
+	if runch == nil {
+		return
 	}
+	if *skip_identical && binHash == runningBinaries[buildpath] {
+		infof("binary is unchanged, not restarting")
+		return
+	}
+	runningBinaries[buildpath] = binHash
+	runch <- true
+	return
+}
 
-	// rerun. if we're only testing, sending
-	if !(*never_run && runch != nil) {
-		runch <- true
+// a target is a main package that is built and run.
+type target struct {
+	buildpath string
+	args      []string
+	runch     chan bool
+	isSetup   bool
+	graph     *depGraph
+}
+
+// rebuild sets the target up, if that didn't succeed before, and builds,
+// tests and reruns it.
+func (t *target) rebuild() {
+	// Re-run setup
+	if !t.isSetup {
+		t.runch, t.isSetup = setup(t.buildpath, t.args)
+	}
+
+	if t.isSetup {
+		buildTestRun(t.buildpath, t.runch)
+	}
+}
+
+// reset stops the program, so the next rebuild sets the target up again
+// with args.
+func (t *target) reset(args []string) {
+	if t.runch != nil {
+		closeRun(t.runch)
+		t.runch = nil
+	}
+	t.isSetup = false
+	t.args = args
+	// restart even if the binary is unchanged.
+	delete(runningBinaries, t.buildpath)
+}
+
+// the run channels closed by closeRun.
+var runs = struct {
+	sync.RWMutex
+	closed map[chan bool]bool
+}{closed: map[chan bool]bool{}}
+
+// restartLater restarts the program of runch from another goroutine, for
+// restarts from the program's output, which must not wait for the program
+// as it waits for its output to be written. Once runch is closed, the
+// restart is dropped.
+func restartLater(runch chan bool) {
+	go func() {
+		runs.RLock()
+		defer runs.RUnlock()
+		if !runs.closed[runch] {
+			runch <- true
+		}
+	}()
+}
+
+// closeRun stops the program of runch and ends its run loop, after the
+// restarts already on their way.
+func closeRun(runch chan bool) {
+	runs.Lock()
+	defer runs.Unlock()
+	runs.closed[runch] = true
+	runch <- false
+	close(runch)
+}
+
+// restart restarts the program without rebuilding it.
+func (t *target) restart() {
+	if t.runch != nil {
+		t.runch <- true
+	}
+}
+
+// watchedDirs returns the directories of the dependencies of all targets,
+// the one of the env file and those of the --rule files.
+func watchedDirs(targets []*target) (dirs []string) {
+	seen := map[string]bool{}
+	if envPath := envFilePath(); envPath != "" {
+		seen[filepath.Dir(envPath)] = true
+		dirs = append(dirs, filepath.Dir(envPath))
+	}
+	for _, dir := range ruleDirs() {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
 	}
+	for _, t := range targets {
+		for _, dir := range t.graph.Dirs() {
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return
 }
 
-func rerun(buildpath string, args []string) (err error) {
-	runch, isSetup := setup(buildpath, args)
+func rerunLoop(buildpaths []string, args []string) (err error) {
+	startJanitor()
+	startHooks()
+	traceEvents()
+	watchSelf()
+	handleSignals()
+
+	err = loadScript()
+	if err != nil {
+		return
+	}
+
+	var triggers chan string
+	if *ctl_enabled || *vcs_hooks {
+		triggers, err = listenCtl()
+		if err != nil {
+			return
+		}
+		infof("listening for control commands on %s", ctlSocket)
+	}
+	if (*keys_enabled || *status_addr != "" || script != nil) && triggers == nil {
+		triggers = make(chan string)
+	}
+	if script != nil {
+		script.triggers = triggers
+		startScriptEvents()
+	}
+	if *status_addr != "" {
+		err = serveStatus(*status_addr, triggers)
+		if err != nil {
+			return
+		}
+	}
+	if *cover_addr != "" {
+		err = serveCoverage(*cover_addr)
+		if err != nil {
+			return
+		}
+	}
+	if *keys_enabled {
+		err = listenKeys(triggers)
+		if err != nil {
+			return
+		}
+		defer restoreTerminal()
+	}
+
+	targets := make([]*target, len(buildpaths))
+	for i, buildpath := range buildpaths {
+		targets[i] = &target{buildpath: buildpath, args: args}
+		targets[i].rebuild()
+	}
 
-	if isSetup {
-		buildTestRun(buildpath, runch)
+	if *vcs_hooks {
+		return rerunOnTrigger(targets, triggers)
 	}
 
-	var watcher *fsnotify.Watcher
-	watcher, err = getWatcher(buildpath)
+	for _, t := range targets {
+		t.graph = newDepGraph(t.buildpath)
+		exitIfStrict(reportImportErrors(t.graph))
+	}
+	isSource := func(name string) bool {
+		if name == envFilePath() {
+			return true
+		}
+		if isFuzzCorpus(name) {
+			return false
+		}
+		if isRuleFile(name) {
+			return true
+		}
+		for _, t := range targets {
+			if t.graph.isSource(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	hashes := contentHashes{}
+	hashes.addDirs(watchedDirs(targets))
+	hashes.changed([]string{envFilePath()})
+	var merging conflicts
+	var watcher rerun.Watcher
+	watcher, err = getWatcher(watchedDirs(targets))
 	if err != nil {
 		return
 	}
 
+	// changes and triggers are collected while paused, and handled on
+	// resume.
+	var paused bool
+	var pending []rerun.Change
+	// the last trigger that arrived while paused.
+	var pendingTrigger string
 	for {
-		// read event from the watcher
-		we, _ := <-watcher.Event
-		// other files in the directory don't count - we watch the whole thing in case new .go files appear.
-		if filepath.Ext(we.Name) != ".go" {
+		changes, source, triggered := rerun.NextChange(watcher, isSource, triggers)
+		if triggered {
+			key, isKey := keyCommand(source)
+			if isKey && key == "p" {
+				source = pauseTrigger
+				if paused {
+					source = resumeTrigger
+				}
+			}
+			if name, ok := profileCommand(source); ok {
+				switchProfile(name, targets)
+				continue
+			}
+			if args, ok := argsCommand(source); ok {
+				setArgs(args, targets)
+				continue
+			}
+			switch {
+			case source == pauseTrigger:
+				if !paused {
+					paused = true
+					log.Println("paused")
+				}
+				continue
+			case source == resumeTrigger:
+				if !paused {
+					continue
+				}
+				paused = false
+				log.Println("resumed")
+				if pendingTrigger != "" {
+					log.Printf("triggered %s while paused", pendingTrigger)
+					pendingTrigger = ""
+					for _, t := range targets {
+						t.rebuild()
+					}
+				}
+				if len(pending) == 0 {
+					continue
+				}
+				changes, pending = pending, nil
+			case isKey && !(paused && key == "r"):
+				handleKey(key, targets)
+				continue
+			case paused:
+				pendingTrigger = source
+				continue
+			default:
+				log.Printf("triggered %s", source)
+				for _, t := range targets {
+					t.rebuild()
+				}
+				continue
+			}
+		}
+		if paused {
+			pending = append(pending, changes...)
+			continue
+		}
+		changes = rerun.Merge(delayChanges(watcher, isSource, changes))
+
+		changes = hashes.changes(changes)
+		if len(changes) == 0 {
+			infof("no content change, skipping")
+			continue
+		}
+		logChanges(changes)
+		if !scriptOnChange(rerun.Names(changes)) {
+			infof("skipped by on_change of %s", script.path)
 			continue
 		}
 
-		log.Print(we.Name)
+		changed := merging.check(rerun.Names(changes))
+		changed, envChanged := withoutEnvFile(changed)
+		if envChanged {
+			log.Printf("%s changed, restarting", *env_file)
+			for _, t := range targets {
+				t.restart()
+			}
+		}
+		changed, reload := applyRules(changed)
+		if reload {
+			for _, t := range targets {
+				t.reload()
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
 
-		// close the watcher
-		watcher.Close()
-		// to clean things up: read events from the watcher until events chan is closed.
-		go func(events chan *fsnotify.FileEvent) {
-			for _ = range events {
+		// only the targets depending on the changed files are rebuilt.
+		var affected []*target
+		var affectedPaths []string
+		all := rebuildsAll(changed)
+		for _, t := range targets {
+			if all || t.graph.contains(changed) {
+				affected = append(affected, t)
+				affectedPaths = append(affectedPaths, t.buildpath)
+			}
+		}
+		if len(targets) > 1 {
+			infof("affected: %s", strings.Join(affectedPaths, ", "))
+		}
+		for _, t := range affected {
+			emit(eventChange, targetName(t.buildpath), strings.Join(changed, " "))
+		}
 
+		if hasModFile(changed) {
+			refreshed := map[string]bool{}
+			for _, t := range affected {
+				modRoot := t.graph.modRoot
+				if refreshed[modRoot] {
+					continue
+				}
+				refreshed[modRoot] = true
+				err := refreshModules(modRoot)
+				if err != nil {
+					log.Print(err)
+				}
+				// the refresh may have rewritten go.mod and go.sum, that is
+				// not a change to react to.
+				hashes.changed([]string{filepath.Join(modRoot, "go.mod"), filepath.Join(modRoot, "go.sum")})
 			}
-		}(watcher.Event)
+		}
 
-		// create a new watcher
-		log.Println("rescanning")
-		watcher, err = getWatcher(buildpath)
+		// update the watcher, packages may have been added or removed.
+		infof("rescanning")
+		for _, t := range affected {
+			t.graph.update(changed)
+			reportImportErrors(t.graph)
+		}
+		watcher, err = updateWatcher(watcher, watchedDirs(targets))
 		if err != nil {
 			return
 		}
+		hashes.addDirs(watchedDirs(targets))
 
-		// we don't need the errors from the new watcher.
-		// we continiously discard them from the channel to avoid a deadlock.
-		go func(errors chan error) {
-			for _ = range errors {
+		cycleChanges = changed
+		for _, t := range affected {
+			t.rebuild()
+		}
+		cycleChanges = nil
+	}
+}
 
+// rerunOnTrigger rebuilds all targets whenever a trigger arrives on the
+// control socket, instead of watching the source.
+func rerunOnTrigger(targets []*target, triggers chan string) (err error) {
+	// triggers arriving while paused are handled on resume.
+	var paused, pending bool
+	for source := range triggers {
+		if key, isKey := keyCommand(source); isKey && key == "p" {
+			source = pauseTrigger
+			if paused {
+				source = resumeTrigger
 			}
-		}(watcher.Error)
-
-		// Re-run setup
-		if !isSetup {
-			runch, isSetup = setup(buildpath, args)
+		}
+		if key, isKey := keyCommand(source); isKey {
+			handleKey(key, targets)
+			continue
+		}
+		if name, ok := profileCommand(source); ok {
+			switchProfile(name, targets)
+			continue
+		}
+		if args, ok := argsCommand(source); ok {
+			setArgs(args, targets)
+			continue
+		}
+		switch {
+		case source == pauseTrigger:
+			if !paused {
+				paused = true
+				log.Println("paused")
+			}
+			continue
+		case source == resumeTrigger:
+			if !paused {
+				continue
+			}
+			paused = false
+			log.Println("resumed")
+			if !pending {
+				continue
+			}
+			pending = false
+		case paused:
+			pending = true
+			continue
+		default:
+			log.Printf("triggered %s", source)
 		}
 
-		if isSetup {
-			buildTestRun(buildpath, runch)
+		for _, t := range targets {
+			t.rebuild()
 		}
 	}
 	return
@@ -274,13 +889,135 @@ func rerun(buildpath string, args []string) (err error) {
 func main() {
 	flag.Parse()
 
-	if len(flag.Args()) < 1 {
-		log.Fatal("Usage: rerun [--test] [--no-run] [--build] [--race] <import path> [arg]*")
+	err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	setupCrossBuild()
+	if *self_reexec && runtime.GOOS == "windows" {
+		log.Fatal("--reexec is not supported on windows, where rerun can't replace itself")
+	}
+
+	if len(flag.Args()) < 1 && len(target_paths) == 0 {
+		log.Fatal("Usage: rerun [--test] [--no-run] [--build] [--race] [--vcs-hooks] [--ctl] [--keys] [--once] <import path> [arg]*\n       rerun [flags] <import path>... -- [arg]*\n       rerun ctl trigger [source] | profile [name] | events [kind=<kind>,...] [target=<name>] | install-hooks\n       rerun start [flags] <import path> [arg]* | stop | status | logs [-f]\n       rerun bundle export [file] | import <file>\n       rerun secret set|get|delete <name>\n       rerun stats [sessions] | export [--format=csv|json] [sessions]\n       rerun clean\n       rerun init --from=air|reflex|realize|compiledaemon")
+	}
+
+	if flag.Arg(0) == "bundle" {
+		err := bundleCmd(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	buildpath := flag.Args()[0]
-	args := flag.Args()[1:]
-	err := rerun(buildpath, args)
+	if flag.Arg(0) == "secret" {
+		err := secretCmd(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "stats" {
+		err := stats(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "init" {
+		err := initCmd(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "clean" {
+		clean()
+		return
+	}
+
+	switch flag.Arg(0) {
+	case "start":
+		err := startDaemon(daemonArgs())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "stop":
+		err := stopDaemon()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "status":
+		daemonStatus()
+		return
+	case "logs":
+		err := daemonLogs(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "ctl" {
+		err := ctl(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *record_path != "" {
+		err = startRecording(*record_path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// with "--", all import paths before it are built and run with the
+	// arguments after it.
+	var buildpaths, args []string
+	if len(flag.Args()) > 0 {
+		buildpaths, args = flag.Args()[:1], flag.Args()[1:]
+	}
+	for i, arg := range flag.Args() {
+		if arg == "--" {
+			buildpaths, args = flag.Args()[:i], flag.Args()[i+1:]
+			break
+		}
+	}
+	buildpaths = append(buildpaths, target_paths...)
+	args = programArgs(args)
+	for i := range buildpaths {
+		buildpaths[i], err = resolveMain(buildpaths[i])
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	buildpaths = uniqueTargets(buildpaths)
+	err = setupWorktree()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = startCompose()
+	if err != nil {
+		stopCompose()
+		log.Fatal(err)
+	}
+	if *run_once {
+		code := once(buildpaths, args)
+		unlockPorts()
+		stopCompose()
+		os.Exit(code)
+	}
+	err = rerunLoop(buildpaths, args)
+	unlockPorts()
+	removePidFile()
+	stopCompose()
 	if err != nil {
 		log.Print(err)
 	}
@@ -0,0 +1,24 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// processRSS returns the resident memory of the process pid in bytes.
+func processRSS(pid int) (rss int64, err error) {
+	out, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return
+	}
+	rss, err = strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	return rss << 10, err
+}
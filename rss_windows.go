@@ -0,0 +1,43 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+
+const processVMRead = 0x0010
+
+type processMemoryCounters struct {
+	Cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// processRSS returns the working set of the process pid in bytes.
+func processRSS(pid int) (rss int64, err error) {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION|processVMRead, false, uint32(pid))
+	if err != nil {
+		return
+	}
+	defer syscall.CloseHandle(h)
+	var counters processMemoryCounters
+	counters.Cb = uint32(unsafe.Sizeof(counters))
+	ok, _, e := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&counters)), uintptr(counters.Cb))
+	if ok == 0 {
+		return 0, e
+	}
+	return int64(counters.WorkingSetSize), nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var change_rules stringList
+
+func init() {
+	flag.Var(&change_rules, "rule", "Run a command instead of rebuilding when a changed file matches a glob (repeatable): '<glob> -> <command>', e.g. '*.proto -> buf generate'; '(default pipeline)' as the command rebuilds, '(reload)' sends --reload-signal to the program")
+}
+
+// the command of rules that rebuild the program.
+const defaultPipeline = "(default pipeline)"
+
+// a rule maps changed files matching glob to a command. Globs without a
+// slash match the base name of files anywhere.
+type rule struct {
+	glob, command string
+}
+
+// rules returns the --rule rules, in order.
+func rules() (rs []rule) {
+	for _, r := range change_rules {
+		arrow := strings.Index(r, "->")
+		if arrow < 0 {
+			log.Printf("expected --rule='<glob> -> <command>', got %q", r)
+			continue
+		}
+		rs = append(rs, rule{strings.TrimSpace(r[:arrow]), strings.TrimSpace(r[arrow+2:])})
+	}
+	return
+}
+
+func (r rule) matches(name string) bool {
+	rel := relativeName(name)
+	if !strings.Contains(r.glob, "/") {
+		ok, _ := path.Match(r.glob, path.Base(rel))
+		return ok
+	}
+	return matchGlob(r.glob, rel)
+}
+
+// ruleFor returns the first rule matching name.
+func ruleFor(name string) (r rule, ok bool) {
+	for _, r = range rules() {
+		if r.matches(name) {
+			return r, true
+		}
+	}
+	return
+}
+
+// isRuleFile reports whether name matches a rule.
+func isRuleFile(name string) bool {
+	_, ok := ruleFor(name)
+	return ok
+}
+
+// rebuildsAll reports whether a file of a default pipeline rule, that is
+// not a Go source file of a target, is among changed. All targets are
+// rebuilt then.
+func rebuildsAll(changed []string) bool {
+	for _, name := range changed {
+		r, ok := ruleFor(name)
+		if ok && r.command == defaultPipeline && filepath.Ext(name) != ".go" {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleDirs returns the directories holding the files of the rules.
+func ruleDirs() (dirs []string) {
+	for _, r := range rules() {
+		glob := r.glob
+		if !strings.Contains(glob, "/") {
+			glob = "**/" + glob
+		}
+		dirs = append(dirs, globDirs(glob)...)
+	}
+	return
+}
+
+// applyRules runs the command of every rule matching a changed file,
+// once, in the order of the rules. It returns the changed files that
+// rebuild the program: those of default pipeline rules and those not
+// matching any rule, and whether a file of a reload rule changed.
+func applyRules(changed []string) (rebuild []string, reload bool) {
+	matched := map[rule]bool{}
+	for _, name := range changed {
+		r, ok := ruleFor(name)
+		switch {
+		case !ok || r.command == defaultPipeline:
+			rebuild = append(rebuild, name)
+		case r.command == reloadProgram:
+			reload = true
+		default:
+			matched[r] = true
+		}
+	}
+	for _, r := range rules() {
+		if !matched[r] {
+			continue
+		}
+		delete(matched, r)
+		log.Printf("%s changed, running %s", r.glob, r.command)
+		cmd := shellCommand(r.command)
+		cmd.Stdout = newPrefixWriter(os.Stdout, "["+r.glob+"] ")
+		cmd.Stderr = newPrefixWriter(os.Stderr, "["+r.glob+"] ")
+		err := cmd.Run()
+		if err != nil {
+			log.Printf("error on running %s: '%s'\n", r.command, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,39 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// schemaVersion is the version of the JSON rerun writes, of the routes of
+// the control socket and the status server, and of the config format. It
+// only changes when one of them changes incompatibly, see schema/ for
+// their JSON Schemas.
+const schemaVersion = 1
+
+// versionPrefix is the prefix of the routes of this schema version. The
+// routes are served without it as well.
+var versionPrefix = "/v" + strconv.Itoa(schemaVersion)
+
+// handleVersioned adds handler for path, with and without versionPrefix.
+func handleVersioned(mux *http.ServeMux, path string, handler http.HandlerFunc) {
+	mux.HandleFunc(path, handler)
+	mux.HandleFunc(versionPrefix+path, handler)
+}
+
+// checkSchemaVersion fails for configs written for a newer rerun.
+func checkSchemaVersion(value string) (err error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("schema_version: %s", err)
+	}
+	if v > schemaVersion {
+		return fmt.Errorf("schema_version %d is newer than the %d of this rerun, update rerun", v, schemaVersion)
+	}
+	return
+}
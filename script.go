@@ -0,0 +1,233 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var script_path = flag.String("script", "", "Starlark script with on_change, should_run, args and on_event functions deciding what rerun does (default rerun.star next to the config file, if there)")
+
+// the trigger the script sends to rebuild all targets.
+const scriptTrigger = "script"
+
+// a rerunScript is a loaded --script. Its globals are frozen, so its
+// functions can be called from any goroutine.
+type rerunScript struct {
+	path     string
+	globals  starlark.StringDict
+	triggers chan string
+}
+
+// script is the loaded --script, nil without one.
+var script *rerunScript
+
+// scriptFile returns the path of the script to load, "" for none.
+func scriptFile() string {
+	if *script_path != "" {
+		return *script_path
+	}
+	if isRemoteConfig(*config_path) {
+		return ""
+	}
+	path := filepath.Join(filepath.Dir(*config_path), "rerun.star")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// loadScript runs the script, leaving its functions for rerun to call.
+func loadScript() (err error) {
+	path := scriptFile()
+	if path == "" {
+		return
+	}
+	s := &rerunScript{path: path}
+	predeclared := starlark.StringDict{
+		"rerun": &starlarkstruct.Module{Name: "rerun", Members: starlark.StringDict{
+			"log":     starlark.NewBuiltin("log", scriptLog),
+			"getenv":  starlark.NewBuiltin("getenv", scriptGetenv),
+			"rebuild": starlark.NewBuiltin("rebuild", s.rebuild),
+		}},
+	}
+	s.globals, err = starlark.ExecFileOptions(&syntax.FileOptions{}, s.thread(), path, nil, predeclared)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	s.globals.Freeze()
+	script = s
+	infof("loaded %s", path)
+	return
+}
+
+func (s *rerunScript) thread() *starlark.Thread {
+	return &starlark.Thread{
+		Name: s.path,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("[%s] %s", filepath.Base(s.path), msg)
+		},
+	}
+}
+
+// call calls the function name of the script, returning nil if it has
+// none or it failed.
+func (s *rerunScript) call(name string, args ...starlark.Value) starlark.Value {
+	if s == nil {
+		return nil
+	}
+	fn, ok := s.globals[name].(starlark.Callable)
+	if !ok {
+		return nil
+	}
+	v, err := starlark.Call(s.thread(), fn, args, nil)
+	if err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			err = fmt.Errorf("%s", evalErr.Backtrace())
+		}
+		log.Printf("error on calling %s of %s: '%s'\n", name, s.path, err)
+		return nil
+	}
+	return v
+}
+
+// decides returns whether the result v of a script function says yes,
+// and whether it decided at all: None leaves it to rerun.
+func decides(v starlark.Value) (yes bool, decided bool) {
+	if v == nil || v == starlark.None {
+		return false, false
+	}
+	return bool(v.Truth()), true
+}
+
+func stringValues(names []string) *starlark.List {
+	values := make([]starlark.Value, len(names))
+	for i, name := range names {
+		values[i] = starlark.String(name)
+	}
+	return starlark.NewList(values)
+}
+
+// scriptOnChange returns whether the changed files are handled, asking the
+// on_change function of the script.
+func scriptOnChange(changed []string) bool {
+	rel := make([]string, len(changed))
+	for i, name := range changed {
+		rel[i] = relativeName(name)
+	}
+	yes, decided := decides(script.call("on_change", stringValues(rel)))
+	return yes || !decided
+}
+
+// scriptShouldRun asks the should_run function of the script whether to
+// run phase, see shouldRun.
+func scriptShouldRun(phase string) (yes bool, decided bool) {
+	var rel []string
+	for _, name := range cycleChanges {
+		rel = append(rel, relativeName(name))
+	}
+	return decides(script.call("should_run", starlark.String(phase), stringValues(rel)))
+}
+
+// scriptArgs returns the args of the program at binPath, as the args
+// function of the script computes them from the configured ones.
+func scriptArgs(binPath string, args []string) []string {
+	name := strings.TrimSuffix(filepath.Base(binPath), ".exe")
+	v := script.call("args", starlark.String(name), stringValues(args))
+	if v == nil || v == starlark.None {
+		return args
+	}
+	iter := starlark.Iterate(v)
+	if iter == nil {
+		log.Printf("error on calling args of %s: 'expected a list, got %s'\n", script.path, v.Type())
+		return args
+	}
+	defer iter.Done()
+	var computed []string
+	var x starlark.Value
+	for iter.Next(&x) {
+		arg, ok := starlark.AsString(x)
+		if !ok {
+			arg = x.String()
+		}
+		computed = append(computed, arg)
+	}
+	return computed
+}
+
+// startScriptEvents passes the events to the on_event function of the
+// script, one at a time and in order, like startHooks.
+func startScriptEvents() {
+	if script == nil {
+		return
+	}
+	if _, ok := script.globals["on_event"].(starlark.Callable); !ok {
+		return
+	}
+	s := subscribe(nil, "")
+	go func() {
+		for ev := range s.events {
+			script.call("on_event", starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+				"kind":    starlark.String(ev.Kind),
+				"target":  starlark.String(ev.Target),
+				"message": starlark.String(ev.Message),
+				"time":    starlark.String(ev.Time.Format(time.RFC3339)),
+			}))
+		}
+	}()
+}
+
+// scriptLog is rerun.log(msg, ...), logging its args like print.
+func scriptLog(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		if s, ok := starlark.AsString(arg); ok {
+			words[i] = s
+		} else {
+			words[i] = arg.String()
+		}
+	}
+	thread.Print(thread, strings.Join(words, " "))
+	return starlark.None, nil
+}
+
+// scriptGetenv is rerun.getenv(name, default=""), like os.Getenv.
+func scriptGetenv(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, def string
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "default?", &def)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		value = def
+	}
+	return starlark.String(value), nil
+}
+
+// rebuild is rerun.rebuild(), rebuilding and restarting all targets once
+// the loop gets to it.
+func (s *rerunScript) rebuild(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	err := starlark.UnpackArgs(b.Name(), args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if s.triggers == nil {
+		return nil, fmt.Errorf("%s: not available while loading the script", b.Name())
+	}
+	go func() {
+		s.triggers <- scriptTrigger
+	}()
+	return starlark.None, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	secrets      stringList
+	secret_ttl   = flag.Duration("secret-ttl", 0, "Reuse fetched secrets for this long instead of fetching them on every start")
+	age_identity = flag.String("age-identity", "", "Identity file used to decrypt age: secrets")
+)
+
+func init() {
+	flag.Var(&secrets, "secret", "Secret put into the environment of the program and its hooks (repeatable): NAME=vault:<path>#<field>, NAME=keychain:<name>, sops:<file> or age:<file>")
+}
+
+var secretCache struct {
+	sync.Mutex
+	env     []string
+	fetched time.Time
+}
+
+// secretEnv returns the environment with all secrets, fetching them
+// again if the cached ones are older than --secret-ttl.
+func secretEnv() (env []string, err error) {
+	if len(secrets) == 0 {
+		return
+	}
+
+	secretCache.Lock()
+	defer secretCache.Unlock()
+	if secretCache.env != nil && time.Since(secretCache.fetched) < *secret_ttl {
+		env = secretCache.env
+		return
+	}
+
+	for _, secret := range secrets {
+		var senv []string
+		senv, err = fetchSecret(secret)
+		if err != nil {
+			// secrets must not end up in the logs, only the source does.
+			err = fmt.Errorf("fetching secret %s: %s", secretSource(secret), err)
+			return
+		}
+		env = append(env, senv...)
+	}
+	secretCache.env, secretCache.fetched = env, time.Now()
+	return
+}
+
+// secretSource strips the variable name from a --secret.
+func secretSource(secret string) string {
+	for _, source := range []string{"=vault:", "=keychain:"} {
+		if i := strings.Index(secret, source); i >= 0 {
+			return secret[i+1:]
+		}
+	}
+	return secret
+}
+
+func fetchSecret(secret string) (env []string, err error) {
+	var out []byte
+	switch {
+	case strings.HasPrefix(secret, "sops:"):
+		out, err = secretCommand("sops", "--decrypt", "--output-type", "dotenv", strings.TrimPrefix(secret, "sops:"))
+		env = parseDotenv(out)
+	case strings.HasPrefix(secret, "age:"):
+		args := []string{"--decrypt"}
+		if *age_identity != "" {
+			args = append(args, "--identity", *age_identity)
+		}
+		out, err = secretCommand("age", append(args, strings.TrimPrefix(secret, "age:"))...)
+		env = parseDotenv(out)
+	case strings.Contains(secret, "=vault:"):
+		i := strings.Index(secret, "=vault:")
+		name, source := secret[:i], strings.TrimPrefix(secret[i+1:], "vault:")
+		hash := strings.LastIndex(source, "#")
+		if hash < 0 {
+			err = fmt.Errorf("expected vault:<path>#<field>")
+			return
+		}
+		out, err = secretCommand("vault", "kv", "get", "-field="+source[hash+1:], source[:hash])
+		env = []string{name + "=" + strings.TrimRight(string(out), "\r\n")}
+	case strings.Contains(secret, "=keychain:"):
+		i := strings.Index(secret, "=keychain:")
+		var value string
+		value, err = keychainGet(strings.TrimPrefix(secret[i+1:], "keychain:"))
+		env = []string{secret[:i] + "=" + value}
+	default:
+		err = fmt.Errorf("unknown secret source, expected NAME=vault:<path>#<field>, NAME=keychain:<name>, sops:<file> or age:<file>")
+	}
+	if err != nil {
+		env = nil
+	}
+	return
+}
+
+func secretCommand(name string, args ...string) (out []byte, err error) {
+	return runSecretCommand(exec.Command(name, args...))
+}
+
+// runSecretCommand returns the output of cmd, its error output goes into
+// err.
+func runSecretCommand(cmd *exec.Cmd) (out []byte, err error) {
+	stderr := bytes.NewBuffer([]byte{})
+	cmd.Stderr = stderr
+	out, err = cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("%s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return
+}
+
+// parseDotenv returns the KEY=VALUE lines of a .env file, without comments
+// and with the values unquoted.
+func parseDotenv(data []byte) (env []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, key+"="+value)
+	}
+	return
+}
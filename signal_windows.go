@@ -0,0 +1,16 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// parseSignal fails, processes on windows can't be sent signals.
+func parseSignal(name string) (sig os.Signal, err error) {
+	err = errors.New("signals are not supported on windows")
+	return
+}
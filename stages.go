@@ -0,0 +1,119 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"log"
+	"os"
+	"strings"
+)
+
+// a stage is a step of the pipeline, defined in a [stage.<name>] section
+// of the config file or with --phase.
+type stage struct {
+	name    string
+	command string
+	// globs of the files whose changes run the stage, in addition to
+	// those of --when.
+	when []string
+	// the built-in step the stage runs before: build, test or run.
+	before string
+	// stop, the default, keeps the program from being restarted when the
+	// stage fails. continue carries on.
+	onFail string
+}
+
+// the stages of the config file, in order.
+var pipelineStages []stage
+
+// parseStage returns the stage name configured by c:
+//
+//	command = "buf generate"  # the shell command, required
+//	when = ["**/*.proto"]     # only run when a matching file changed
+//	before = "build"          # build, test or run, the default
+//	on-fail = "continue"      # or stop, the default
+func parseStage(name string, c config) (st stage, err error) {
+	st = stage{name: name, before: "run", onFail: "stop"}
+	for key, values := range c {
+		switch key {
+		case "command":
+			st.command = strings.Join(values, " ")
+		case "when":
+			st.when = values
+		case "before":
+			st.before = strings.Join(values, "")
+		case "on-fail":
+			st.onFail = strings.Join(values, "")
+		default:
+			err = fmt.Errorf("unknown setting %q", key)
+			return
+		}
+	}
+	switch {
+	case st.command == "":
+		err = errors.New("no command")
+	case st.before != "build" && st.before != "test" && st.before != "run":
+		err = fmt.Errorf("before is %q, expected build, test or run", st.before)
+	case st.onFail != "stop" && st.onFail != "continue":
+		err = fmt.Errorf("on-fail is %q, expected stop or continue", st.onFail)
+	}
+	return
+}
+
+// stages returns the stages of the config file followed by those of
+// --phase, which run before the program.
+func stages() (all []stage) {
+	all = append(all, pipelineStages...)
+	for _, p := range custom_phases {
+		eq := strings.Index(p, "=")
+		if eq < 0 {
+			log.Printf("expected --phase=NAME=<command>, got %q", p)
+			continue
+		}
+		all = append(all, stage{name: p[:eq], command: p[eq+1:], before: "run", onFail: "stop"})
+	}
+	return
+}
+
+// stageGlobs returns the when globs of the stage name.
+func stageGlobs(name string) (globs []string) {
+	for _, st := range pipelineStages {
+		if st.name == name {
+			globs = append(globs, st.when...)
+		}
+	}
+	return
+}
+
+// stageSteps returns the steps of the stages running before the built-in
+// step, in order. A failing stage fails its step when its failure policy
+// is stop.
+func stageSteps(before string) (steps []rerun.Step) {
+	for _, st := range stages() {
+		if st.before != before || !shouldRun(st.name) {
+			continue
+		}
+		st := st
+		steps = append(steps, rerun.Step{Name: st.name, Run: func() error {
+			cmd := shellCommand(st.command)
+			cmd.Stdout = newPrefixWriter(os.Stdout, "["+st.name+"] ")
+			cmd.Stderr = newPrefixWriter(os.Stderr, "["+st.name+"] ")
+			err := cmd.Run()
+			if err == nil {
+				return nil
+			}
+			if st.onFail == "continue" {
+				log.Printf("%s failed: %s, continuing", st.name, err)
+				return nil
+			}
+			fmt.Printf("%s failed: %s\n", st.name, err)
+			return err
+		}})
+	}
+	return
+}
@@ -0,0 +1,132 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var status_addr = flag.String("status-addr", "", "Serve the state of the loop as JSON on this address, e.g. :7777, with prometheus metrics on /metrics")
+
+// the status of a program, as served on --status-addr.
+type targetStatus struct {
+	State     string     `json:"state"`
+	LastError string     `json:"last_error,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Uptime    string     `json:"uptime,omitempty"`
+	Builds    int        `json:"builds"`
+	Failures  int        `json:"failures"`
+
+	// for /metrics
+	buildStarted   time.Time
+	buildDurations histogram
+	buildFailures  int
+	runs           int
+	restarts       int
+}
+
+var loopStatus = struct {
+	sync.Mutex
+	started time.Time
+	targets map[string]*targetStatus
+}{started: time.Now(), targets: map[string]*targetStatus{}}
+
+// updateStatus keeps loopStatus up to date with ev. It is called by emit
+// for every event, unlike subscribers, which miss events when they fall
+// behind, so the counters of the metrics are exact.
+func updateStatus(ev event) {
+	loopStatus.Lock()
+	defer loopStatus.Unlock()
+	t := loopStatus.targets[ev.Target]
+	if t == nil {
+		t = &targetStatus{}
+		loopStatus.targets[ev.Target] = t
+	}
+	switch ev.Kind {
+	case eventState:
+		t.State = ev.Message
+	case eventBuildStart:
+		t.Builds++
+		t.buildStarted = ev.Time
+	case eventBuildFailed, eventTestFailed, eventIntegrationFailed:
+		t.Failures++
+		t.LastError = ev.Message
+		if ev.Kind == eventBuildFailed {
+			t.buildFailures++
+			t.buildDurations.observe(ev.Time.Sub(t.buildStarted))
+		}
+	case eventBuildPassed:
+		t.LastError = ""
+		t.buildDurations.observe(ev.Time.Sub(t.buildStarted))
+	case eventRunStart:
+		started := ev.Time
+		t.StartedAt = &started
+		if t.runs > 0 {
+			t.restarts++
+		}
+		t.runs++
+	case eventRunExit:
+		t.StartedAt = nil
+	}
+}
+
+// serveStatus serves the status on addr. POST /restart rebuilds and
+// restarts all programs through triggers. The other control commands are
+// only served on the control socket, guarded by its file permissions.
+func serveStatus(addr string, triggers chan string) (err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	handleVersioned(mux, "/", func(w http.ResponseWriter, r *http.Request) {
+		// "/" matches every path the other handlers don't.
+		if r.URL.Path != "/" && r.URL.Path != versionPrefix+"/" {
+			http.NotFound(w, r)
+			return
+		}
+		loopStatus.Lock()
+		targets := map[string]targetStatus{}
+		for name, t := range loopStatus.targets {
+			ts := *t
+			if ts.StartedAt != nil {
+				ts.Uptime = roundDuration(time.Since(*ts.StartedAt)).String()
+			}
+			targets[name] = ts
+		}
+		uptime := roundDuration(time.Since(loopStatus.started)).String()
+		loopStatus.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"schema_version": schemaVersion,
+			"uptime":         uptime,
+			"targets":        targets,
+		})
+	})
+	handleVersioned(mux, "/metrics", serveMetrics)
+	handleVersioned(mux, "/restart", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		triggers <- "status endpoint"
+		fmt.Fprintln(w, "ok")
+	})
+	go func() {
+		err := http.Serve(l, mux)
+		log.Printf("error on serving status: '%s'\n", err)
+	}()
+	log.Printf("serving status on %s", l.Addr())
+	return
+}
@@ -0,0 +1,40 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+)
+
+var stdin_files stringList
+
+func init() {
+	flag.Var(&stdin_files, "stdin-file", "Feed this file to the program's stdin, cycled through on every run when given multiple times")
+}
+
+// the number of runs a stdin fixture was picked for.
+var stdinRuns int
+
+// nextStdinFixture returns the content fed to the program's stdin on the
+// next run. It is nil without --stdin-file.
+func nextStdinFixture() (fixture []byte) {
+	if len(stdin_files) == 0 {
+		return
+	}
+	name := stdin_files[stdinRuns%len(stdin_files)]
+	stdinRuns++
+
+	fixture, err := ioutil.ReadFile(name)
+	if err != nil {
+		log.Printf("error on reading stdin fixture: '%s'\n", err)
+		return
+	}
+	if len(stdin_files) > 1 {
+		log.Printf("feeding %s", name)
+	}
+	return
+}
@@ -0,0 +1,70 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"github.com/ccll/rerun/pkg/rerun"
+	"log"
+	"sort"
+)
+
+var strict = flag.Bool("strict", false, "Exit when setting up fails, e.g. when a directory cannot be watched or a package not imported, instead of going on without it")
+
+// exitIfStrict exits rerun with --strict when setting up failed.
+func exitIfStrict(failed bool) {
+	if failed && *strict {
+		log.Print("setting up failed, exiting because of --strict")
+		exitRerun(1)
+	}
+}
+
+// reportImportErrors logs the errors importing the packages of g, and
+// reports whether there were any.
+func reportImportErrors(g *depGraph) (failed bool) {
+	var paths []string
+	for importpath := range g.importErrs {
+		paths = append(paths, importpath)
+	}
+	sort.Strings(paths)
+	for _, importpath := range paths {
+		log.Printf("error on importing %s: '%s'\n", importpath, g.importErrs[importpath])
+	}
+	return len(paths) > 0
+}
+
+// reportWatchErrors logs the directories that cannot be watched, and
+// returns the other errors. failed reports whether there were any.
+func reportWatchErrors(err error) (failed bool, other error) {
+	dirsErr, ok := err.(rerun.DirsError)
+	if !ok {
+		return false, err
+	}
+	var dirs []string
+	for dir := range dirsErr {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		log.Printf("error on watching %s: '%s'\n", dir, dirsErr[dir])
+	}
+	return true, nil
+}
+
+// logWatcherErrors logs the errors of watcher's notifications, for the
+// watchers reporting them.
+func logWatcherErrors(watcher rerun.Watcher) {
+	w, ok := watcher.(interface {
+		Errors() <-chan error
+	})
+	if !ok {
+		return
+	}
+	go func() {
+		for err := range w.Errors() {
+			log.Printf("error on watching for changes: '%s'\n", err)
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var auto_fix = flag.Bool("auto-fix", false, "Apply safe fixes for build failures, like go get for a missing module")
+
+var (
+	missingModuleRE = regexp.MustCompile(`no required module provides package (\S+?);|cannot find package "([^"]+)"`)
+	goVersionRE     = regexp.MustCompile(`go\.mod requires go >= (\S+)`)
+	cgoRE           = regexp.MustCompile(`C source files not allowed when not using cgo|undefined: C\.|cgo: C compiler "[^"]*" not found`)
+	undefinedRE     = regexp.MustCompile(`^undefined: (\w+)$`)
+	declRE          = regexp.MustCompile(`^[-+]\s*(?:func(?:\s*\([^)]*\))?|type|var|const)\s+(\w+)`)
+)
+
+// suggestFixes returns one line hints for the failures in a build's
+// output it recognizes. With --auto-fix, missing modules are fetched.
+func suggestFixes(output string, diags []diagnostic) (hints []string) {
+	seen := map[string]bool{}
+	hint := func(format string, a ...interface{}) {
+		h := fmt.Sprintf(format, a...)
+		if !seen[h] {
+			seen[h] = true
+			hints = append(hints, h)
+		}
+	}
+
+	for _, m := range missingModuleRE.FindAllStringSubmatch(output, -1) {
+		pkg := m[1] + m[2]
+		if *auto_fix && strings.Contains(pkg, ".") {
+			log.Printf("fetching missing module for %s", pkg)
+			out, err := exec.Command("go", "get", pkg).CombinedOutput()
+			if err == nil {
+				continue
+			}
+			log.Printf("error on fetching %s: '%s'\n", pkg, strings.TrimSpace(string(out)))
+		}
+		hint("missing module for %s, run: go get %s", pkg, pkg)
+	}
+	if m := goVersionRE.FindStringSubmatch(output); m != nil {
+		hint("go.mod asks for go %s: install it, set GOTOOLCHAIN=auto, or lower the go line in go.mod", m[1])
+	}
+	if cgoRE.MatchString(output) {
+		hint("the package needs cgo: set CGO_ENABLED=1 and make sure a C compiler is installed")
+	}
+	for _, d := range diags {
+		m := undefinedRE.FindStringSubmatch(d.Msg)
+		if m == nil {
+			continue
+		}
+		if renamed := findRename(m[1]); renamed != "" {
+			hint("%s was renamed to %s, update the callers, e.g.: gofmt -r '%s -> %s' -w .", m[1], renamed, m[1], renamed)
+		}
+	}
+	return
+}
+
+// findRename looks in the uncommitted changes for a declaration of name
+// that was replaced by one of another name, and returns that name.
+func findRename(name string) (renamed string) {
+	out, err := exec.Command("git", "diff", "-U0", "HEAD", "--", "*.go").Output()
+	if err != nil {
+		return
+	}
+	// a rename removes the old declaration and adds the new one in the
+	// same hunk.
+	removed := false
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			removed = false
+			continue
+		}
+		m := declRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		switch {
+		case line[0] == '-' && m[1] == name:
+			removed = true
+		case line[0] == '+' && removed && m[1] != name:
+			return m[1]
+		}
+	}
+	return
+}
+
+// printHints prints the hints of suggestFixes.
+func printHints(hints []string) {
+	for _, h := range hints {
+		fmt.Println("hint: " + h)
+	}
+}
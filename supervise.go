@@ -0,0 +1,96 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	restart_every = flag.Duration("restart-every", 0, "Restart the program this often, e.g. 30m, for programs that pile up state or leak")
+	max_rss       byteSize
+)
+
+func init() {
+	flag.Var(&max_rss, "max-rss", "Restart the program when its resident memory grows beyond this, e.g. 1G or 512M")
+}
+
+// how often the memory of the program is checked for --max-rss.
+const rssInterval = 2 * time.Second
+
+// a byteSize is a flag holding a number of bytes, with an optional K, M
+// or G suffix.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) (err error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		shift = 10
+	case strings.HasSuffix(value, "M"):
+		shift = 20
+	case strings.HasSuffix(value, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("expected a size like 1G or 512M")
+	}
+	*b = byteSize(n * float64(int64(1)<<shift))
+	return
+}
+
+// supervise calls restart when the running program c is due for a
+// restart, until it exits.
+func supervise(c *child, restart func()) {
+	if *restart_every <= 0 && max_rss <= 0 {
+		return
+	}
+	go func() {
+		var every <-chan time.Time
+		if *restart_every > 0 {
+			every = time.After(*restart_every)
+		}
+		var sample <-chan time.Time
+		if max_rss > 0 {
+			ticker := time.NewTicker(rssInterval)
+			defer ticker.Stop()
+			sample = ticker.C
+		}
+		for {
+			select {
+			case <-c.exited:
+				return
+			case <-every:
+				log.Printf("%s ran for %s, restarting", c.name, *restart_every)
+				restart()
+				return
+			case <-sample:
+				rss, err := processRSS(c.cmd.Process.Pid)
+				if err != nil {
+					continue
+				}
+				if rss > int64(max_rss) {
+					log.Printf("%s uses %d MiB of memory, more than --max-rss, restarting", c.name, rss>>20)
+					restart()
+					return
+				}
+			}
+		}
+	}()
+}
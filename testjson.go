@@ -0,0 +1,139 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var test_verbose = flag.Bool("test-verbose", false, "Print the whole output of --test, not only the one of the failing tests")
+
+// a testEvent is a line of the output of go test -json.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// a testReport is the outcome of a run of go test -json, by top-level
+// test.
+type testReport struct {
+	// all of the output, as go test -v prints it.
+	output []byte
+	// the output of the tests, including the one of their subtests.
+	outputs map[string][]byte
+	// the output that is not of a test, like build errors.
+	other []byte
+
+	passed, failed, skipped []string
+	elapsed                 map[string]time.Duration
+	total                   time.Duration
+}
+
+// parseTestEvents returns the report of the output of go test -json.
+// Lines that aren't events, like build errors, are part of the output
+// as they are.
+func parseTestEvents(out []byte) (r testReport) {
+	r.outputs = map[string][]byte{}
+	r.elapsed = map[string]time.Duration{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var ev testEvent
+		if !bytes.HasPrefix(line, []byte("{")) || json.Unmarshal(line, &ev) != nil {
+			line = append(line, '\n')
+			r.output = append(r.output, line...)
+			r.other = append(r.other, line...)
+			continue
+		}
+		r.output = append(r.output, ev.Output...)
+		elapsed := time.Duration(ev.Elapsed * float64(time.Second))
+		if ev.Test == "" {
+			r.other = append(r.other, ev.Output...)
+			if ev.Action == "pass" || ev.Action == "fail" {
+				r.total += elapsed
+			}
+			continue
+		}
+		name := strings.SplitN(ev.Test, "/", 2)[0]
+		r.outputs[name] = append(r.outputs[name], ev.Output...)
+		if name != ev.Test {
+			continue
+		}
+		switch ev.Action {
+		case "pass":
+			r.passed = append(r.passed, name)
+		case "fail":
+			r.failed = append(r.failed, name)
+		case "skip":
+			r.skipped = append(r.skipped, name)
+		default:
+			continue
+		}
+		r.elapsed[name] = elapsed
+	}
+	return
+}
+
+// print prints the output of the failing tests, all of it with
+// --test-verbose, and a summary with the slowest tests.
+func (r testReport) print() {
+	switch {
+	case *test_verbose:
+		os.Stdout.Write(r.output)
+	case len(r.failed) > 0:
+		for _, name := range r.failed {
+			os.Stdout.Write(r.outputs[name])
+		}
+	case len(r.passed) == 0 && len(r.skipped) == 0:
+		// the tests didn't build, or failed outside of a test.
+		os.Stdout.Write(r.other)
+	}
+
+	if len(r.passed)+len(r.failed)+len(r.skipped) == 0 {
+		return
+	}
+	summary := fmt.Sprintf("%d passed, %d failed, %d skipped in %s", len(r.passed), len(r.failed), len(r.skipped), roundDuration(r.total))
+	if slowest := r.slowest(3); len(slowest) > 0 {
+		summary += ", slowest: " + strings.Join(slowest, ", ")
+	}
+	if len(r.failed) == 0 {
+		infof("%s", summary)
+		return
+	}
+	log.Print(summary)
+	log.Printf("failed: %s", strings.Join(r.failed, " "))
+}
+
+// slowest returns the n slowest tests with their durations, leaving out
+// those taking no time.
+func (r testReport) slowest(n int) (tests []string) {
+	names := make([]string, 0, len(r.elapsed))
+	for name, d := range r.elapsed {
+		if d > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return r.elapsed[names[i]] > r.elapsed[names[j]] })
+	if len(names) > n {
+		names = names[:n]
+	}
+	for _, name := range names {
+		tests = append(tests, fmt.Sprintf("%s (%s)", name, roundDuration(r.elapsed[name])))
+	}
+	return
+}
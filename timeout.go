@@ -0,0 +1,52 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+var (
+	build_timeout = flag.Duration("build-timeout", 0, "Kill the go command building the program when it takes longer than this, e.g. hanging on a network fetch, and keep the running program")
+	test_timeout  = flag.Duration("test-timeout", 0, "Kill the go command running the tests when it takes longer than this, and keep the running program")
+)
+
+// a timeoutError is returned by runTimeout when the command took too long.
+type timeoutError struct {
+	what    string
+	timeout time.Duration
+}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s and was killed", e.what, e.timeout)
+}
+
+// runTimeout runs cmd like cmd.Run, but kills it when it runs longer than
+// timeout, if not 0. It doesn't wait for the processes cmd started then,
+// which may still hold on to its output.
+func runTimeout(cmd *exec.Cmd, timeout time.Duration, what string) (err error) {
+	logCommand(cmd)
+	if timeout <= 0 {
+		return cmd.Run()
+	}
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+		return
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return timeoutError{what, timeout}
+	}
+}
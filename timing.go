@@ -0,0 +1,92 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a phaseStat sums up how long a phase took over all cycles.
+type phaseStat struct {
+	count int
+	total time.Duration
+}
+
+// the stats by phase, in the order the phases first ran, for the summary
+// on exit.
+var phaseStats = struct {
+	sync.Mutex
+	m     map[string]*phaseStat
+	order []string
+}{m: map[string]*phaseStat{}}
+
+// timePhase returns a func that records the time since the call, for
+// phase. It returns the duration as well.
+func timePhase(phase string) func() time.Duration {
+	start := time.Now()
+	return func() time.Duration {
+		d := time.Since(start)
+		recordPhase(phase, d)
+		return d
+	}
+}
+
+// recordPhase adds a run of phase that took d to the stats.
+func recordPhase(phase string, d time.Duration) {
+	phaseStats.Lock()
+	defer phaseStats.Unlock()
+	s := phaseStats.m[phase]
+	if s == nil {
+		s = &phaseStat{}
+		phaseStats.m[phase] = s
+		phaseStats.order = append(phaseStats.order, phase)
+	}
+	s.count++
+	s.total += d
+}
+
+// roundDuration rounds d to what is worth printing: 300ms, 1.2s.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
+
+// a phaseLog collects the durations of the phases of one cycle.
+type phaseLog []phaseTime
+
+type phaseTime struct {
+	phase string
+	d     time.Duration
+}
+
+func (l *phaseLog) add(phase string, d time.Duration) {
+	*l = append(*l, phaseTime{phase, d})
+}
+
+// print logs the durations, like "build 1.2s, tests 4.8s".
+func (l phaseLog) print() {
+	var parts []string
+	for _, p := range l {
+		parts = append(parts, p.phase+" "+roundDuration(p.d).String())
+	}
+	if len(parts) > 0 {
+		infof("%s", strings.Join(parts, ", "))
+	}
+}
+
+// printPhaseSummary logs the totals and averages of all phases.
+func printPhaseSummary() {
+	phaseStats.Lock()
+	defer phaseStats.Unlock()
+	for _, phase := range phaseStats.order {
+		s := phaseStats.m[phase]
+		log.Printf("%s: %d times, %s in total, %s on average", phase, s.count, roundDuration(s.total), roundDuration(s.total/time.Duration(s.count)))
+	}
+}
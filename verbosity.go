@@ -0,0 +1,102 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+var (
+	quiet        = flag.Bool("quiet", false, "Only log errors and restarts")
+	verbose      = flag.Bool("v", false, "Also log the go command lines and which directories are watched")
+	very_verbose = flag.Bool("vv", false, "Like -v, and also log every event")
+)
+
+func init() {
+	flag.BoolVar(quiet, "q", false, "Short for --quiet")
+}
+
+// infof logs what rerun is doing, unless --quiet.
+func infof(format string, a ...interface{}) {
+	if !*quiet {
+		log.Printf(format, a...)
+	}
+}
+
+// verbosef logs details for debugging rerun, with -v or -vv.
+func verbosef(format string, a ...interface{}) {
+	if *verbose || *very_verbose {
+		log.Printf(format, a...)
+	}
+}
+
+// logChanges logs the files that changed at the start of a cycle, with
+// how they changed.
+func logChanges(changes []rerun.Change) {
+	if *quiet {
+		return
+	}
+	lines := []string{"changed files:"}
+	for _, c := range changes {
+		lines = append(lines, fmt.Sprintf("  %-6s %s", c.Op, relativeName(c.Name)))
+	}
+	log.Print(strings.Join(lines, "\n"))
+}
+
+// logCommand logs the command line of cmd with -v.
+func logCommand(cmd *exec.Cmd) {
+	verbosef("running %s", strings.Join(cmd.Args, " "))
+}
+
+// the directories watched, for logging the changes with -v.
+var watchedNow = map[string]bool{}
+
+// logWatched logs the directories that are watched from now on, and those
+// no longer watched, with -v.
+func logWatched(dirs []string) {
+	if !*verbose && !*very_verbose {
+		return
+	}
+	want := map[string]bool{}
+	var added, removed []string
+	for _, dir := range dirs {
+		want[dir] = true
+		if !watchedNow[dir] {
+			added = append(added, dir)
+		}
+	}
+	for dir := range watchedNow {
+		if !want[dir] {
+			removed = append(removed, dir)
+		}
+	}
+	sort.Strings(removed)
+	for _, dir := range added {
+		verbosef("watching %s", dir)
+	}
+	for _, dir := range removed {
+		verbosef("no longer watching %s", dir)
+	}
+	watchedNow = want
+}
+
+// traceEvents logs every event with -vv.
+func traceEvents() {
+	if !*very_verbose {
+		return
+	}
+	s := subscribe(nil, "")
+	go func() {
+		for ev := range s.events {
+			log.Printf("event %s target=%q message=%q", ev.Kind, ev.Target, ev.Message)
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	wait_for         = flag.String("wait-for", "", "Comma separated services to wait for before the first start, e.g. tcp://localhost:5432,http://localhost:9200/_cluster/health")
+	wait_for_timeout = flag.Duration("wait-for-timeout", time.Minute, "How long to wait for the services of --wait-for")
+)
+
+var servicesOnce sync.Once
+
+// waitForServices waits, before the program is started the first time,
+// until the services of --wait-for are reachable: tcp:// ones accept
+// connections, http(s):// ones answer with 2xx.
+func waitForServices() {
+	servicesOnce.Do(func() {
+		if *wait_for == "" {
+			return
+		}
+		deadline := time.Now().Add(*wait_for_timeout)
+		for _, service := range strings.Split(*wait_for, ",") {
+			service = strings.TrimSpace(service)
+			if !isService(service) {
+				log.Printf("ignoring --wait-for %s, expected tcp://, http:// or https://", service)
+				continue
+			}
+			start := time.Now()
+			lastLog := start
+			for {
+				err := checkService(service)
+				if err == nil {
+					if time.Since(start) > time.Second {
+						log.Printf("%s is up after %s", service, roundDuration(time.Since(start)))
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					log.Printf("%s is still not reachable after %s, starting anyway: %s", service, *wait_for_timeout, err)
+					return
+				}
+				if time.Since(lastLog) > 5*time.Second || lastLog == start {
+					log.Printf("waiting for %s: %s", service, err)
+					lastLog = time.Now()
+				}
+				time.Sleep(500 * time.Millisecond)
+			}
+		}
+	})
+}
+
+func isService(service string) bool {
+	u, err := url.Parse(service)
+	return err == nil && (u.Scheme == "tcp" || u.Scheme == "http" || u.Scheme == "https")
+}
+
+func checkService(service string) (err error) {
+	u, err := url.Parse(service)
+	if err != nil {
+		return
+	}
+	switch u.Scheme {
+	case "tcp":
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", u.Host, 2*time.Second)
+		if err == nil {
+			conn.Close()
+		}
+	default:
+		client := http.Client{Timeout: 2 * time.Second}
+		var resp *http.Response
+		resp, err = client.Get(service)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	return
+}
@@ -0,0 +1,129 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	wasm_mode = flag.Bool("wasm", false, "Build the program for GOOS=js GOARCH=wasm and serve it, reloading the browsers on every build")
+	wasm_addr = flag.String("wasm-addr", "localhost:8080", "Address --wasm serves the program on")
+)
+
+// the page loading the program, unless its package has an index.html.
+const wasmIndex = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<script src="/wasm_exec.js"></script>
+<script>
+const go = new Go();
+WebAssembly.instantiateStreaming(fetch("/main.wasm"), go.importObject).then((result) => go.run(result.instance));
+</script>
+<script src="/_rerun/reload.js"></script>
+</head>
+<body></body>
+</html>
+`
+
+// runWasm serves the program and its package directory, and reloads the
+// browsers on every launch.
+func runWasm(binName, binPath, dir string) (runch chan bool) {
+	runch = make(chan bool)
+	err := serveWasm(binPath, dir)
+	if err != nil {
+		log.Printf("error on serving %s: '%s'\n", binName, err)
+	}
+	go func() {
+		for relaunch := range runch {
+			if !relaunch {
+				continue
+			}
+			reloadBrowsers()
+			emit(eventRunStart, binName, "")
+			emit(eventState, binName, stateRunning)
+		}
+	}()
+	return
+}
+
+func serveWasm(binPath, dir string) (err error) {
+	wasmExec, err := wasmExecPath()
+	if err != nil {
+		return
+	}
+	l, err := net.Listen("tcp", *wasm_addr)
+	if err != nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+			http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+			return
+		}
+		page := []byte(wasmIndex)
+		if custom, err := ioutil.ReadFile(filepath.Join(dir, "index.html")); err == nil {
+			page = injectReload(custom)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(page)
+	})
+	mux.HandleFunc("/wasm_exec.js", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, wasmExec)
+	})
+	mux.HandleFunc("/main.wasm", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/wasm")
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(w, r, binPath)
+	})
+	handleReload(mux)
+	go func() {
+		err := http.Serve(l, mux)
+		log.Printf("error on serving wasm: '%s'\n", err)
+	}()
+	log.Printf("serving the program on http://%s", l.Addr())
+	return
+}
+
+// wasmExecPath returns the wasm_exec.js of the Go installation, which
+// must match the Go version the program is built with.
+func wasmExecPath() (path string, err error) {
+	goroot := os.Getenv("GOROOT")
+	if goroot == "" {
+		out, err := exec.Command("go", "env", "GOROOT").Output()
+		if err != nil {
+			return "", err
+		}
+		goroot = strings.TrimSpace(string(out))
+	}
+	// Go 1.24 moved it from misc/wasm to lib/wasm.
+	for _, dir := range []string{"lib", "misc"} {
+		path = filepath.Join(goroot, dir, "wasm", "wasm_exec.js")
+		if _, err = os.Stat(path); err == nil {
+			return
+		}
+	}
+	return "", fmt.Errorf("no wasm_exec.js in %s", goroot)
+}
+
+// setupWasm builds for js/wasm with --wasm.
+func setupWasm() {
+	if *wasm_mode {
+		*target_goos, *target_goarch = "js", "wasm"
+	}
+}
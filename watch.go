@@ -0,0 +1,83 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"log"
+	"runtime"
+)
+
+var watch_vendor = flag.Bool("watch-vendor", false, "Also watch the vendored packages in vendor/, to rebuild on edits to them")
+
+var watch_backend = flag.String("watch-backend", "auto", "How to watch for changes: inotify (a watch per directory), fsevents (a watch per tree, with FSEvents on macOS and ReadDirectoryChangesW on Windows), watchman (a subscription per project), poll, or auto")
+
+// getWatcher watches dirs. The directories beyond the system's watches
+// are polled, and without any watches at all, everything is.
+func getWatcher(dirs []string) (watcher rerun.Watcher, err error) {
+	logWatched(dirs)
+	watcher, err = newWatcher(dirs)
+	failed, err := reportWatchErrors(reportWatchLimit(err))
+	exitIfStrict(failed)
+	if rerun.IsWatchLimit(err) {
+		log.Printf("cannot watch for changes (%s), polling every %s instead", err, rerun.DefaultPollInterval)
+		logWatchLimitHint(err, len(dirs))
+		watcher, err = rerun.NewPoller(dirs, rerun.DefaultPollInterval), nil
+	}
+	if err == nil {
+		logWatcherErrors(watcher)
+	}
+	return
+}
+
+// newWatcher returns the watcher of --watch-backend. auto watches whole
+// trees on macOS and Windows when it can, and every directory elsewhere.
+func newWatcher(dirs []string) (rerun.Watcher, error) {
+	backend := *watch_backend
+	if *poll_interval > 0 {
+		backend = "poll"
+	}
+	switch backend {
+	case "auto":
+		if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+			watcher, err := rerun.NewTreeWatcher(dirs)
+			if err == nil {
+				return watcher, nil
+			}
+			verbosef("cannot watch whole trees (%s), watching every directory instead", err)
+		}
+		return rerun.NewFSWatcher(dirs)
+	case "inotify":
+		return rerun.NewFSWatcher(dirs)
+	case "fsevents":
+		return rerun.NewTreeWatcher(dirs)
+	case "watchman":
+		return rerun.NewWatchman(dirs)
+	case "poll":
+		interval := *poll_interval
+		if interval <= 0 {
+			interval = rerun.DefaultPollInterval
+		}
+		return rerun.NewPoller(dirs, interval), nil
+	}
+	return nil, fmt.Errorf("unknown --watch-backend %q, want auto, inotify, fsevents, watchman or poll", backend)
+}
+
+// updateWatcher makes watcher watch dirs. The directories beyond the
+// system's watches are polled, and without any watches at all, watcher is
+// replaced with a poller.
+func updateWatcher(watcher rerun.Watcher, dirs []string) (rerun.Watcher, error) {
+	logWatched(dirs)
+	_, err := reportWatchErrors(reportWatchLimit(watcher.SetDirs(dirs)))
+	if rerun.IsWatchLimit(err) {
+		log.Printf("cannot watch for changes (%s), polling every %s instead", err, rerun.DefaultPollInterval)
+		logWatchLimitHint(err, len(dirs))
+		watcher.Close()
+		return rerun.NewPoller(dirs, rerun.DefaultPollInterval), nil
+	}
+	return watcher, err
+}
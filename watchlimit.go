@@ -0,0 +1,80 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ccll/rerun/pkg/rerun"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// the number of directories polled for lack of watches, as last reported.
+var pollingDirs int
+
+// reportWatchLimit logs the directories polled because the system ran out
+// of watches, whenever their number changes, with how to raise the limit.
+// Other errors are returned.
+func reportWatchLimit(err error) error {
+	limitErr, ok := err.(*rerun.WatchLimitError)
+	if !ok {
+		if err == nil {
+			pollingDirs = 0
+		}
+		return err
+	}
+	if len(limitErr.Unwatched) != pollingDirs {
+		pollingDirs = len(limitErr.Unwatched)
+		log.Printf("cannot watch %d of the %d directories (%s), polling them every %s instead",
+			len(limitErr.Unwatched), limitErr.Needed, limitErr.Err, rerun.DefaultPollInterval)
+		logWatchLimitHint(limitErr.Err, limitErr.Needed)
+	}
+	return nil
+}
+
+// logWatchLimitHint logs how to raise the limit err ran into, for
+// watching needed directories.
+func logWatchLimitHint(err error, needed int) {
+	switch {
+	case runtime.GOOS == "linux" && errors.Is(err, syscall.ENOSPC):
+		logSysctlHint("fs.inotify.max_user_watches", needed,
+			fmt.Sprintf("rerun needs %d inotify watches, one per directory", needed))
+	case runtime.GOOS == "linux" && errors.Is(err, syscall.EMFILE):
+		logSysctlHint("fs.inotify.max_user_instances", 1,
+			"all inotify instances are taken, e.g. by editors and other watchers")
+	case errors.Is(err, syscall.EMFILE):
+		log.Printf("rerun needs %d open files, one per directory, raise the limit e.g. with\n\tulimit -n %d", needed, roundLimit(1024, needed))
+	}
+}
+
+// logSysctlHint logs the limit of the sysctl name, and the commands
+// raising it to fit needed more.
+func logSysctlHint(name string, needed int, why string) {
+	data, err := ioutil.ReadFile("/proc/sys/" + strings.Replace(name, ".", "/", -1))
+	if err != nil {
+		return
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return
+	}
+	raised := roundLimit(limit, needed)
+	log.Printf("%s, the limit of %s is %d for all programs of the user. Raise it with\n\tsudo sysctl %s=%d\nand add %s=%d to /etc/sysctl.conf to keep it after reboots",
+		why, name, limit, name, raised, name, raised)
+}
+
+// roundLimit returns limit doubled until there is room for needed more.
+func roundLimit(limit, needed int) int {
+	raised := limit * 2
+	for raised < limit+needed {
+		raised *= 2
+	}
+	return raised
+}
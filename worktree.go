@@ -0,0 +1,148 @@
+// Copyright 2013 The rerun AUTHORS. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ports stringList
+
+func init() {
+	flag.Var(&ports, "port", "Port put into the program's environment (repeatable): NAME=<port>, moved up by 100 in every other git worktree of the repository")
+}
+
+// the ports of the n-th worktree are moved up by n*portStep.
+const portStep = 100
+
+// where the binaries are installed in a worktree other than the main one.
+var worktreeBinDir = filepath.Join(".rerun", "bin")
+
+// the lock file keeping two reruns with --port in one worktree apart.
+var portLockPath = filepath.Join(".rerun", "port.lock")
+
+// a worktree is the git worktree rerun runs in.
+type worktree struct {
+	name string
+	// index is the position in "git worktree list", 0 for the main
+	// worktree.
+	index int
+}
+
+// currentWorktree returns the worktree rerun runs in, ok is false when
+// the repository has no other worktrees.
+func currentWorktree() (wt worktree, ok bool) {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return
+	}
+	top := filepath.Clean(strings.TrimSpace(string(out)))
+	out, err = exec.Command("git", "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		return
+	}
+	var paths []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "worktree ") {
+			paths = append(paths, filepath.Clean(strings.TrimPrefix(line, "worktree ")))
+		}
+	}
+	if len(paths) < 2 {
+		return
+	}
+	for i, path := range paths {
+		if path == top {
+			return worktree{name: filepath.Base(top), index: i}, true
+		}
+	}
+	return
+}
+
+// worktreePorts are the --port variables with the ports of the worktree.
+var worktreePorts []string
+
+// setupWorktree namespaces the ports and binaries when the repository
+// has several worktrees, so rerun can run in each of them at once.
+func setupWorktree() (err error) {
+	wt, ok := currentWorktree()
+	offset := 0
+	if ok {
+		offset = wt.index * portStep
+		if wt.index > 0 {
+			bin, err := filepath.Abs(worktreeBinDir)
+			if err != nil {
+				return err
+			}
+			os.Setenv("GOBIN", bin)
+		}
+	}
+
+	worktreePorts = nil
+	var summary []string
+	for _, p := range ports {
+		eq := strings.Index(p, "=")
+		if eq < 0 {
+			return fmt.Errorf("expected --port=NAME=<port>, got %q", p)
+		}
+		base, err := strconv.Atoi(p[eq+1:])
+		if err != nil {
+			return fmt.Errorf("expected --port=NAME=<port>, got %q", p)
+		}
+		name, port := p[:eq], base+offset
+		worktreePorts = append(worktreePorts, name+"="+strconv.Itoa(port))
+		note := ""
+		if l, err := net.Listen("tcp", ":"+strconv.Itoa(port)); err != nil {
+			note = " (in use)"
+		} else {
+			l.Close()
+		}
+		summary = append(summary, fmt.Sprintf("%s=%d%s", name, port, note))
+	}
+	if len(ports) > 0 {
+		err = lockPorts()
+		if err != nil {
+			return
+		}
+	}
+
+	if ok {
+		log.Printf("worktree %s (#%d), installing to %s", wt.name, wt.index, os.Getenv("GOBIN"))
+	}
+	if len(summary) > 0 {
+		log.Printf("ports: %s", strings.Join(summary, ", "))
+	}
+	return
+}
+
+// lockPorts makes sure no other rerun in this worktree uses the ports.
+func lockPorts() (err error) {
+	err = os.MkdirAll(filepath.Dir(portLockPath), 0755)
+	if err != nil {
+		return
+	}
+	if data, err := ioutil.ReadFile(portLockPath); err == nil {
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid > 0 && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("rerun with --port is already running in this worktree (pid %d)", pid)
+		}
+	}
+	return ioutil.WriteFile(portLockPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// unlockPorts removes the lock of lockPorts.
+func unlockPorts() {
+	if len(ports) > 0 {
+		os.Remove(portLockPath)
+	}
+}